@@ -0,0 +1,216 @@
+package adabot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// An actuator is a named motor or servo of the robot, set to a value whose
+// meaning depends on its type, see Actuate.
+type actuator struct {
+	kind     string
+	min, max float64 // soft limits of the value, none when equal
+	home     float64 // value the evaluator sets it to when bare
+	set      func(value float64) error
+	get      func() float64
+	dc       *dcMotor // a declared DC motor, nil for the others
+}
+
+// ActuatorState describes an actuator and its current value.
+type ActuatorState struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// dcMotor is the state of a declared DC motor.
+type dcMotor struct {
+	cfg   TrackConfig
+	power float64 // signed power applied, guarded by bot.mu
+}
+
+// addActuators registers the built in actuators and the ones declared in
+// cfg.  The servos and the steppers must be set up first.
+func (bot *Robot) addActuators(cfg *Config) error {
+	bot.actuators = map[string]*actuator{
+		"left_track":  bot.trackActuator(&bot.left),
+		"right_track": bot.trackActuator(&bot.right),
+		"yaw":         bot.servoActuator(&bot.yaw),
+		"pitch":       bot.servoActuator(&bot.pitch),
+	}
+	if bot.stepMotor != nil {
+		bot.actuators["stepper"] = bot.stepperActuator(bot.stepMotor, 0, 0)
+	}
+	for name, a := range cfg.Actuators {
+		switch a.Type {
+		case ActuatorDC:
+			bot.actuators[name] = bot.dcActuator(a)
+		case ActuatorServo:
+			s := newServo(ServoConfig{Channel: byte(a.Channel), Min: int(a.Min), Max: int(a.Max)})
+			s.invert = a.Invert
+			bot.servos = append(bot.servos, &s)
+			bot.actuators[name] = bot.servoActuator(&s)
+		case ActuatorStepper:
+			if bot.stepper == nil {
+				return fmt.Errorf("actuator %s: the drive has no steppers", name)
+			}
+			m := &stepperMotor{cfg: StepperConfig{Port: a.Channel, StepsPerRev: a.StepsPerRev,
+				RPM: a.RPM}, invert: a.Invert}
+			bot.actuators[name] = bot.stepperActuator(m, a.Min, a.Max)
+		}
+	}
+	return nil
+}
+
+// trackActuator drives one track, leaving the other one be.
+func (bot *Robot) trackActuator(tr *track) *actuator {
+	return &actuator{
+		kind: ActuatorDC,
+		min:  -1,
+		max:  1,
+		set: func(power float64) error {
+			bot.mu.Lock()
+			left, right := bot.left.target, bot.right.target
+			bot.mu.Unlock()
+			if tr == &bot.left {
+				left = power
+			} else {
+				right = power
+			}
+			return bot.Drive(left, right)
+		},
+		get: func() float64 {
+			bot.mu.Lock()
+			defer bot.mu.Unlock()
+			return tr.power
+		},
+	}
+}
+
+// dcActuator runs a declared DC motor at once, without ramping, until the
+// next command or the watchdog.  Like the tracks, it fails on a flat
+// battery and a low one limits its power.
+func (bot *Robot) dcActuator(cfg ActuatorConfig) *actuator {
+	m := &dcMotor{cfg: TrackConfig{Motor: cfg.Channel, Invert: cfg.Invert}}
+	a := &actuator{kind: ActuatorDC, min: cfg.Min, max: cfg.Max, dc: m}
+	if a.min == 0 && a.max == 0 {
+		a.min, a.max = -1, 1
+	}
+	a.set = func(power float64) (err error) {
+		if bot.EStopped() {
+			return ErrEStop
+		}
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		if power != 0 {
+			if power, _, err = bot.limitPower(power, 0); err != nil {
+				return
+			}
+			bot.feed()
+		}
+		if err = bot.runTrack(m.cfg, power); err != nil {
+			return
+		}
+		m.power = power
+		return
+	}
+	a.get = func() float64 {
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		return m.power
+	}
+	return a
+}
+
+// releaseDC releases the declared DC motors, the running ones only unless
+// all is set.  It reports whether any was running.  The caller must hold
+// bot.mu.
+func (bot *Robot) releaseDC(all bool) (running bool, err error) {
+	for _, a := range bot.actuators {
+		if a.dc == nil || (a.dc.power == 0 && !all) {
+			continue
+		}
+		running = running || a.dc.power != 0
+		a.dc.power = 0
+		if e := bot.drive.RunDCMotor(a.dc.cfg.Motor, MotorRelease); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// servoActuator moves a servo to an angle (in deg).
+func (bot *Robot) servoActuator(s *servo) *actuator {
+	return &actuator{
+		kind: ActuatorServo,
+		min:  float64(s.cfg.Min),
+		max:  float64(s.cfg.Max),
+		home: float64(s.cfg.center()),
+		set: func(deg float64) error {
+			bot.podMu.Lock()
+			defer bot.podMu.Unlock()
+			return bot.setServo(s, int(math.Round(deg)))
+		},
+		get: func() float64 {
+			bot.podMu.Lock()
+			defer bot.podMu.Unlock()
+			return float64(s.deg)
+		},
+	}
+}
+
+// stepperActuator turns a stepper to a position (in full steps).
+func (bot *Robot) stepperActuator(m *stepperMotor, min, max float64) *actuator {
+	return &actuator{
+		kind: ActuatorStepper,
+		min:  min,
+		max:  max,
+		set:  func(pos float64) error { return bot.stepTo(m, pos) },
+		get:  func() float64 { return bot.position(m) },
+	}
+}
+
+// Actuate sets the named actuator to the given value, clamped to its soft
+// limits: the signed power of a track or DC motor, -1 to 1, the angle of a
+// servo (in deg), or the position of a stepper (in full steps).  Tracks
+// and DC motors run until the next command, servos move as configured and
+// steppers return once there.
+func (bot *Robot) Actuate(name string, value float64) error {
+	a, ok := bot.actuators[name]
+	if !ok {
+		return fmt.Errorf("no actuator %q", name)
+	}
+	if math.IsNaN(value) {
+		return fmt.Errorf("%s: not a number", name)
+	}
+	if a.min < a.max {
+		value = math.Max(a.min, math.Min(a.max, value))
+	}
+	return a.set(value)
+}
+
+// Actuator returns the state of the named actuator.
+func (bot *Robot) Actuator(name string) (ActuatorState, error) {
+	a, ok := bot.actuators[name]
+	if !ok {
+		return ActuatorState{}, fmt.Errorf("no actuator %q", name)
+	}
+	return ActuatorState{Name: name, Type: a.kind, Value: a.get(), Min: a.min, Max: a.max}, nil
+}
+
+// Actuators returns the state of every actuator, by name.
+func (bot *Robot) Actuators() []ActuatorState {
+	names := make([]string, 0, len(bot.actuators))
+	for name := range bot.actuators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	states := make([]ActuatorState, len(names))
+	for i, name := range names {
+		states[i], _ = bot.Actuator(name)
+	}
+	return states
+}
@@ -0,0 +1,188 @@
+package adabot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newActuatorRobot(t *testing.T) (*Robot, *SimDrive) {
+	cfg, err := LoadConfig("profiles/gripper.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cfg.Actuators["lift"] = ActuatorConfig{Type: ActuatorStepper, Channel: 0, Max: 100,
+		StepsPerRev: 200, RPM: 600}
+	// the winch takes DC motor 1 off the lift
+	delete(cfg.Actuators, "winch")
+	return newSimRobotConfig(t, instant(cfg))
+}
+
+func TestActuators(t *testing.T) {
+	bot, _ := newActuatorRobot(t)
+
+	var names []string
+	for _, a := range bot.Actuators() {
+		names = append(names, a.Name+":"+a.Type)
+	}
+	want := "[gripper:servo left_track:dc lift:stepper pitch:servo right_track:dc yaw:servo]"
+	if got := fmt.Sprint(names); got != want {
+		t.Errorf("Expected: %s, Got: %s\n", want, got)
+	}
+	if err := bot.Actuate("flipper", 1); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+}
+
+func TestActuateServo(t *testing.T) {
+	bot, sim := newActuatorRobot(t)
+
+	// clamped to the soft limits
+	if err := bot.Actuate("gripper", 200); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if p := sim.Pulse(3); p != 480 {
+		t.Errorf("Expected: 480, Got: %d\n", p)
+	}
+	if a, _ := bot.Actuator("gripper"); a.Value != 110 {
+		t.Errorf("Expected: 110, Got: %g\n", a.Value)
+	}
+	if err := bot.Actuate("yaw", 30); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if deg := bot.YawAngle(); deg != 30 {
+		t.Errorf("Expected: 30, Got: %d\n", deg)
+	}
+}
+
+func TestActuateInverted(t *testing.T) {
+	cfg := instant(DefaultConfig())
+	cfg.Actuators["wrist"] = ActuatorConfig{Type: ActuatorServo, Channel: 5, Max: 180, Invert: true}
+	cfg.Actuators["winch"] = ActuatorConfig{Type: ActuatorDC, Channel: 1, Invert: true}
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	if err := bot.Actuate("wrist", 110); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if p := sim.Pulse(5); p != 360 {
+		t.Errorf("Expected: 360, Got: %d\n", p)
+	}
+	if err := bot.Actuate("winch", 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := sim.Motor(1); m.Speed != 128 || m.Dir != MotorBackward {
+		t.Errorf("Expected: 128 backward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	bot.EStop()
+	if m := sim.Motor(1); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+	if err := bot.Actuate("winch", 0.5); err != ErrEStop {
+		t.Errorf("Expected: %v, Got: %v\n", ErrEStop, err)
+	}
+}
+
+func newWinchRobot(t *testing.T) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.Actuators["winch"] = ActuatorConfig{Type: ActuatorDC, Channel: 0}
+	cfg.Watchdog = 0.05
+	cfg.Battery.Monitor = "ads1015"
+	return newSimRobotConfig(t, cfg)
+}
+
+func TestActuateDCWatchdog(t *testing.T) {
+	bot, sim := newWinchRobot(t)
+
+	if err := bot.Actuate("winch", 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := sim.Motor(0); m.Speed != 128 || m.Dir != MotorForward {
+		t.Errorf("Expected: 128 forward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if m := sim.Motor(0); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+	if a, _ := bot.Actuator("winch"); a.Value != 0 {
+		t.Errorf("Expected: 0, Got: %g\n", a.Value)
+	}
+}
+
+func TestActuateDCBattery(t *testing.T) {
+	bot, sim := newWinchRobot(t)
+	defer bot.Actuate("winch", 0)
+
+	// low: limited to the low power
+	sim.SetBatteryVoltage(6.9)
+	if err := bot.Actuate("winch", -1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := throttle2speed(bot.cfg.Battery.LowPower)
+	if m := sim.Motor(0); m.Speed != want || m.Dir != MotorBackward {
+		t.Errorf("Expected: %d backward, Got: %d %s\n", want, m.Speed, m.Dir)
+	}
+	// flat: refused, but it may still stop
+	sim.SetBatteryVoltage(6.0)
+	if err := bot.Actuate("winch", 0.5); err != ErrBatteryLow {
+		t.Errorf("Expected: %v, Got: %v\n", ErrBatteryLow, err)
+	}
+	if err := bot.Actuate("winch", 0); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+}
+
+func TestActuateTrack(t *testing.T) {
+	bot, sim := newActuatorRobot(t)
+	defer bot.Stop()
+
+	if err := bot.Actuate("right_track", -0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bot.Actuate("left_track", 2); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// both tracks inverted
+	if m := sim.Motor(2); m.Speed != 128 || m.Dir != MotorForward {
+		t.Errorf("Expected: 128 forward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	if m := sim.Motor(3); m.Speed != 255 || m.Dir != MotorBackward {
+		t.Errorf("Expected: 255 backward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	if a, _ := bot.Actuator("left_track"); a.Value != 1 {
+		t.Errorf("Expected: 1, Got: %g\n", a.Value)
+	}
+}
+
+func TestActuateStepper(t *testing.T) {
+	bot, sim := newActuatorRobot(t)
+
+	if err := bot.Actuate("lift", 2.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bot.Actuate("lift", -10); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if a, _ := bot.Actuator("lift"); a.Value != 0 {
+		t.Errorf("Expected: 0, Got: %g\n", a.Value)
+	}
+	// a half step then double steps, there and back
+	if steps := stepCommands(sim); len(steps) != 6 || steps[0].Style != StepInterleave ||
+		steps[1].Style != StepDouble || steps[3].Dir != MotorBackward {
+		t.Errorf("Expected: 6 steps, Got: %+v\n", steps)
+	}
+}
+
+func TestRunActuator(t *testing.T) {
+	bot, sim := newActuatorRobot(t)
+	e := NewEval(bot)
+
+	e.Run("gripper(60)")
+	if p := sim.Pulse(3); p != 330 {
+		t.Errorf("Expected: 330, Got: %d\n", p)
+	}
+	// centered when bare
+	e.Run("gripper")
+	if p := sim.Pulse(3); p != 345 {
+		t.Errorf("Expected: 345, Got: %d\n", p)
+	}
+}
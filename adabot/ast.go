@@ -0,0 +1,409 @@
+package adabot
+
+import (
+	"fmt"
+	"text/scanner"
+)
+
+// A literal is a numeric constant, e.g., 3.141.
+type literal float64
+
+func (l literal) eval(env Env) (Value, error) {
+	return float64(l), nil
+}
+
+// A boolean is a bool constant, true or false.
+type boolean bool
+
+func (b boolean) eval(env Env) (Value, error) {
+	return bool(b), nil
+}
+
+// A unary represents a unary operator expression, e.g., -x.
+type unary struct {
+	op rune // one of '+', '-', '!'
+	x  Expr
+}
+
+func (u unary) eval(env Env) (Value, error) {
+	v, err := u.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if u.op == '!' {
+		b, err := asBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("!: %s", err.Error())
+		}
+		return !b, nil
+	}
+	x, err := asNumber(v)
+	if err != nil {
+		return nil, fmt.Errorf("%c: %s", u.op, err.Error())
+	}
+	switch u.op {
+	case '+':
+		return +x, nil
+	case '-':
+		return -x, nil
+	}
+	return nil, fmt.Errorf("unsupported unary operator: %q", u.op)
+}
+
+// A binary represents a binary operator expression, e.g., x+y.
+type binary struct {
+	op   rune // one of '+', '-', '*', '/', '<', '>', opLE, opGE, opEQ, opNE, opAnd, opOr
+	x, y Expr
+}
+
+func (b binary) eval(env Env) (Value, error) {
+	xv, err := b.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if b.op == opAnd || b.op == opOr {
+		return b.logic(env, xv)
+	}
+	yv, err := b.y.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if b.op == opEQ || b.op == opNE {
+		// numbers and bools compare with their own kind
+		_, xrec := xv.(record)
+		_, yrec := yv.(record)
+		if xrec || yrec || typeName(xv) != typeName(yv) {
+			return nil, fmt.Errorf("%s: cannot compare %s and %s",
+				opString(b.op), typeName(xv), typeName(yv))
+		}
+		return (xv == yv) == (b.op == opEQ), nil
+	}
+	x, err := asNumber(xv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", opString(b.op), err.Error())
+	}
+	y, err := asNumber(yv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", opString(b.op), err.Error())
+	}
+	return b.arith(x, y)
+}
+
+// arith applies an arithmetic or ordering operator to numbers.
+func (b binary) arith(x, y float64) (Value, error) {
+	switch b.op {
+	case '+':
+		return x + y, nil
+	case '-':
+		return x - y, nil
+	case '*':
+		return x * y, nil
+	case '/':
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	case '<':
+		return x < y, nil
+	case '>':
+		return x > y, nil
+	case opLE:
+		return x <= y, nil
+	case opGE:
+		return x >= y, nil
+	}
+	return nil, fmt.Errorf("unsupported binary operator: %q", opString(b.op))
+}
+
+// logic applies && or || to bools, evaluating y only when x does not
+// decide the result.
+func (b binary) logic(env Env, xv Value) (Value, error) {
+	x, err := asBool(xv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", opString(b.op), err.Error())
+	}
+	if x == (b.op == opOr) {
+		return x, nil
+	}
+	yv, err := b.y.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	y, err := asBool(yv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", opString(b.op), err.Error())
+	}
+	return y, nil
+}
+
+// A call represents a function call expression, e.g., w(2, 0.5) or range().
+type call struct {
+	fn   string
+	args []Expr
+}
+
+func (c call) eval(env Env) (Value, error) {
+	switch fn := env[Var(c.fn)].(type) {
+	case sensorFunc:
+		if len(c.args) > 0 {
+			return nil, fmt.Errorf("%s: takes no arguments", c.fn)
+		}
+		v, err := fn()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", c.fn, err.Error())
+		}
+		return v, nil
+	case controlFunc, macro:
+		return nil, fmt.Errorf("%s(...): a command has no value", c.fn)
+	}
+	return nil, fmt.Errorf("%s: undefined", c.fn)
+}
+
+// A selector represents a field of a record, e.g., pose().x.
+type selector struct {
+	x     Expr
+	field string
+}
+
+func (s selector) eval(env Env) (Value, error) {
+	v, err := s.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := v.(record)
+	if !ok {
+		return nil, fmt.Errorf(".%s: a %s has no fields", s.field, typeName(v))
+	}
+	for _, f := range r {
+		if f.name == s.field {
+			return f.value, nil
+		}
+	}
+	return nil, fmt.Errorf(".%s: no such field in %s", s.field, r)
+}
+
+// A block is a sequence of statements, e.g., { w; d }.
+type block []Stmt
+
+// exec runs the statements in order, each once the timed move of the one
+// before is over, and stops at the first that fails.
+func (b block) exec(e *Eval) error {
+	for i, s := range b {
+		if i > 0 {
+			e.bot.WaitMove()
+		}
+		if err := s.exec(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A located statement remembers where it is in the input, to report the
+// errors of its execution there.
+type located struct {
+	Stmt
+	src *source
+	pos scanner.Position
+	end int // offset just past the statement
+}
+
+func (s located) exec(e *Eval) error {
+	err := s.Stmt.exec(e)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		// located by a statement within
+		return err
+	}
+	at := s.src.errorAt(s.pos, s.end, err.Error())
+	at.Err = err
+	return at
+}
+
+// An exprStmt is a command statement, e.g., w(2, 0.5), or an expression
+// whose value is printed, e.g., range().
+type exprStmt struct {
+	x Expr
+}
+
+func (s exprStmt) exec(e *Eval) error {
+	// retrieve the accepted Robot functions from the Env
+	var name Var
+	var args []Expr
+	switch x := s.x.(type) {
+	case Var:
+		name = x
+	case call:
+		name, args = Var(x.fn), x.args
+	}
+	switch fn := e.env[name].(type) {
+	case controlFunc:
+		values, err := e.evalArgs(name, args)
+		if err != nil {
+			return err
+		}
+		if len(values) > len(fn.Params) {
+			return fmt.Errorf("%s: takes at most %d arguments", name, len(fn.Params))
+		}
+		params := append([]float64(nil), fn.Params...)
+		for i, v := range values {
+			if params[i], err = asNumber(v); err != nil {
+				return fmt.Errorf("%s: %s", name, err.Error())
+			}
+		}
+		return fn.Fn(params)
+	case macro:
+		values, err := e.evalArgs(name, args)
+		if err != nil {
+			return err
+		}
+		return fn.call(e, name, values)
+	}
+	v, err := s.x.eval(e.env)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, formatValue(v))
+	return nil
+}
+
+// evalArgs evaluates the arguments of a call to the named command.
+func (e *Eval) evalArgs(name Var, args []Expr) ([]Value, error) {
+	var values []Value
+	for _, arg := range args {
+		v, err := arg.eval(e.env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// An assign is an assignment statement, e.g., speed = 0.5.
+type assign struct {
+	v Var
+	x Expr
+}
+
+func (s assign) exec(e *Eval) error {
+	switch e.env[s.v].(type) {
+	case controlFunc, macro, sensorFunc:
+		return fmt.Errorf("%s: cannot assign to a command", s.v)
+	}
+	x, err := s.x.eval(e.env)
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.v, err.Error())
+	}
+	e.env[s.v] = x
+	return nil
+}
+
+// A repeat is a counted loop statement, e.g., repeat 4 { w; a }.
+type repeat struct {
+	n    Expr
+	body block
+}
+
+// exec runs the body n times, rounded down, each once the timed move of the
+// one before is over.  It ends early once interrupted, see Eval.interrupted.
+func (s repeat) exec(e *Eval) error {
+	v, err := s.n.eval(e.env)
+	if err != nil {
+		return fmt.Errorf("repeat: %s", err.Error())
+	}
+	n, err := asNumber(v)
+	if err != nil {
+		return fmt.Errorf("repeat: %s", err.Error())
+	}
+	for i := 0; i < int(n); i++ {
+		if i > 0 {
+			e.bot.WaitMove()
+		}
+		if err := e.interrupted(); err != nil {
+			return err
+		}
+		if err := s.body.exec(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A while is a conditional loop statement, e.g., while x < 3 { w; x = x + 1 }.
+type while struct {
+	cond Expr
+	body block
+}
+
+// exec runs the body for as long as the condition is true, checked once the
+// timed move of the body before is over.  It ends early once interrupted,
+// see Eval.interrupted.
+func (s while) exec(e *Eval) error {
+	for i := 0; ; i++ {
+		if i > 0 {
+			e.bot.WaitMove()
+		}
+		if err := e.interrupted(); err != nil {
+			return err
+		}
+		cond, err := evalCond(e.env, s.cond)
+		if err != nil {
+			return fmt.Errorf("while: %s", err.Error())
+		}
+		if !cond {
+			return nil
+		}
+		if err := s.body.exec(e); err != nil {
+			return err
+		}
+	}
+}
+
+// evalCond evaluates the condition of a while or an if, a bool.
+func evalCond(env Env, cond Expr) (bool, error) {
+	v, err := cond.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return asBool(v)
+}
+
+// An ifElse is a conditional statement, e.g., if x > 1 { w } else { s }.
+type ifElse struct {
+	cond Expr
+	then block
+	els  Stmt // nil without an else
+}
+
+func (s ifElse) exec(e *Eval) error {
+	cond, err := evalCond(e.env, s.cond)
+	if err != nil {
+		return fmt.Errorf("if: %s", err.Error())
+	}
+	if cond {
+		return s.then.exec(e)
+	}
+	if s.els != nil {
+		return s.els.exec(e)
+	}
+	return nil
+}
+
+// A define is a macro definition statement, e.g.,
+// def square(n = 1) { repeat 4 { move(n); turn(90) } }.
+type define struct {
+	name Var
+	m    macro
+}
+
+func (s define) exec(e *Eval) error {
+	switch e.env[s.name].(type) {
+	case controlFunc, sensorFunc:
+		return fmt.Errorf("%s: cannot redefine a builtin command", s.name)
+	}
+	e.env[s.name] = s.m
+	return nil
+}
@@ -0,0 +1,112 @@
+package adabot
+
+import (
+	"errors"
+	"log"
+	"math"
+)
+
+// ErrBatteryLow is returned by motion commands once the battery charge is
+// below the configured cutoff.
+var ErrBatteryLow = errors.New("battery low")
+
+// Battery is implemented by a Drive that measures its battery.
+type Battery interface {
+	// Voltage returns the battery voltage (in V).
+	Voltage() (float64, error)
+	// Current returns the current drawn from the battery (in A).
+	Current() (float64, error)
+}
+
+// BatteryStatus is a reading of the battery monitor.
+type BatteryStatus struct {
+	Volts float64 `json:"volts"`
+	Amps  float64 `json:"amps"`
+	// Charge is the estimated state of charge, 0 to 1.
+	Charge float64 `json:"charge"`
+}
+
+// charge estimates the state of charge from the battery voltage, linear
+// between the configured empty and full voltages.
+func (c *BatteryConfig) charge(volts float64) float64 {
+	return clamp01((volts - c.Empty) / (c.Full - c.Empty))
+}
+
+// Battery reads the battery monitor.  The current is only measured with a
+// configured amps_per_volt, otherwise it is zero.
+func (bot *Robot) Battery() (status BatteryStatus, err error) {
+	if bot.battery == nil {
+		return status, errors.New("no battery monitor fitted")
+	}
+	if status.Volts, err = bot.battery.Voltage(); err != nil {
+		return
+	}
+	if bot.cfg.Battery.AmpsPerVolt > 0 {
+		if status.Amps, err = bot.battery.Current(); err != nil {
+			return
+		}
+	}
+	status.Charge = bot.cfg.Battery.charge(status.Volts)
+	return
+}
+
+// powerLimit returns the max track power the battery allows, and fails
+// with ErrBatteryLow below the cutoff charge.  Without a battery monitor
+// there is no limit.
+func (bot *Robot) powerLimit() (float64, error) {
+	if bot.battery == nil {
+		return 1, nil
+	}
+	status, err := bot.Battery()
+	if err != nil {
+		return 0, err
+	}
+	cfg := bot.cfg.Battery
+	switch {
+	case status.Charge < cfg.Cutoff:
+		log.Printf("battery: %.2fV, %.0f%%\n", status.Volts, status.Charge*100)
+		return 0, ErrBatteryLow
+	case status.Charge < cfg.Low:
+		return cfg.LowPower, nil
+	}
+	return 1, nil
+}
+
+// limitPower scales both track powers down alike, keeping the arc they
+// drive, so that neither exceeds what the battery allows.  The caller must
+// hold bot.mu.
+func (bot *Robot) limitPower(left, right float64) (float64, float64, error) {
+	limit, err := bot.powerLimit()
+	if err != nil {
+		return 0, 0, err
+	}
+	if peak := math.Max(math.Abs(left), math.Abs(right)); peak > limit {
+		left, right = left*limit/peak, right*limit/peak
+	}
+	return left, right, nil
+}
+
+// checkBattery limits the power of the running tracks as the battery runs
+// low, and halts them, failing a Move or Rotate with ErrBatteryLow, once it
+// is flat.  The caller must hold bot.mu.
+func (bot *Robot) checkBattery() {
+	left, right, err := bot.limitPower(bot.left.target, bot.right.target)
+	switch {
+	case err == ErrBatteryLow:
+		log.Printf("battery: flat, stopping\n")
+		if bot.motion != nil {
+			bot.motion.finish(ErrBatteryLow)
+			bot.motion = nil
+		}
+		bot.cancel()
+		if err = bot.halt(); err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+	case err != nil:
+		log.Printf("battery: %s\n", err.Error())
+	case left != bot.left.target || right != bot.right.target:
+		if err = bot.setTracks(left, right); err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func newBatteryRobot(t *testing.T) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.Battery.Monitor = "ads1015"
+	cfg.Battery.AmpsPerVolt = 1
+	return newSimRobotConfig(t, cfg)
+}
+
+func TestBatteryCharge(t *testing.T) {
+	cfg := DefaultConfig().Battery
+	for _, c := range []struct{ volts, charge float64 }{
+		{6.0, 0}, {6.6, 0}, {7.5, 0.5}, {8.4, 1}, {8.6, 1},
+	} {
+		if got := cfg.charge(c.volts); math.Abs(got-c.charge) > 1e-9 {
+			t.Errorf("%gV: Expected: %g, Got: %g\n", c.volts, c.charge, got)
+		}
+	}
+}
+
+func TestBatteryStatus(t *testing.T) {
+	bot, _ := newBatteryRobot(t)
+
+	status, err := bot.Battery()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if status.Volts != 8 || status.Amps != simIdleAmps {
+		t.Errorf("Expected: 8V at %gA, Got: %+v\n", simIdleAmps, status)
+	}
+	if err = bot.Forward(0, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if status, _ = bot.Battery(); math.Abs(status.Amps-(simIdleAmps+2*simMotorAmps)) > 1e-9 {
+		t.Errorf("Expected: %gA, Got: %gA\n", simIdleAmps+2*simMotorAmps, status.Amps)
+	}
+	bot.Stop()
+
+	// no battery monitor configured
+	bot, _ = newSimRobot(t)
+	if _, err = bot.Battery(); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+	if err = bot.Forward(0, 1); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+	bot.Stop()
+}
+
+func TestBatteryLimitsPower(t *testing.T) {
+	bot, sim := newBatteryRobot(t)
+
+	// 10% charge, below low
+	sim.SetBatteryVoltage(6.78)
+	if err := bot.DriveFor(1, 0.5, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	left, right := sim.Motor(3), sim.Motor(2)
+	if left.Speed != 128 || right.Speed != 64 {
+		t.Errorf("Expected: speeds 128 and 64, Got: %d and %d\n", left.Speed, right.Speed)
+	}
+	// below the limit already
+	if err := bot.DriveFor(0.25, 0.25, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := sim.Motor(3); m.Speed != 64 {
+		t.Errorf("Expected: speed 64, Got: %d\n", m.Speed)
+	}
+	bot.Stop()
+}
+
+func TestBatteryRefusesMotion(t *testing.T) {
+	bot, sim := newBatteryRobot(t)
+
+	// 2% charge, below cutoff
+	sim.SetBatteryVoltage(6.64)
+	if err := bot.Forward(1, 1); err != ErrBatteryLow {
+		t.Errorf("Expected: %v, Got: %v\n", ErrBatteryLow, err)
+	}
+	if _, err := bot.StartRotate(90, 1); err != ErrBatteryLow {
+		t.Errorf("Expected: %v, Got: %v\n", ErrBatteryLow, err)
+	}
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+	// the pod still works
+	if err := bot.SetYaw(10); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+	// charged again
+	sim.SetBatteryVoltage(8.2)
+	if err := bot.Forward(0, 1); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+	bot.Stop()
+}
+
+func TestBatteryDrains(t *testing.T) {
+	bot, sim := newBatteryRobot(t)
+	defer bot.Stop()
+
+	if err := bot.DriveFor(1, 1, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// below low while driving: limited
+	sim.SetBatteryVoltage(6.78)
+	time.Sleep(60 * time.Millisecond)
+	if m := sim.Motor(3); m.Speed != 128 {
+		t.Errorf("Expected: speed 128, Got: %d\n", m.Speed)
+	}
+	// below cutoff: stopped
+	sim.SetBatteryVoltage(6.64)
+	time.Sleep(60 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+
+	// a Move fails
+	sim.SetBatteryVoltage(8.2)
+	m, err := bot.StartMove(10, 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sim.SetBatteryVoltage(6.64)
+	select {
+	case <-m.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected: move stopped, Got: still moving\n")
+	}
+	if err := m.Err(); err != ErrBatteryLow {
+		t.Errorf("Expected: %v, Got: %v\n", ErrBatteryLow, err)
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	cfg := instant(DefaultConfig())
+	cfg.Battery.Monitor = "ads1015"
+	cfg.Range.Sensor = "lidarlite"
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	tm := bot.Telemetry()
+	if tm.Battery == nil || tm.Battery.Volts != 8 {
+		t.Errorf("Expected: 8V, Got: %+v\n", tm.Battery)
+	}
+	if tm.Range != nil || tm.EStop {
+		t.Errorf("Expected: nothing in range and no e-stop, Got: %+v\n", tm)
+	}
+	sim.AddWall(1, -1, 1, 1)
+	if tm = bot.Telemetry(); tm.Range == nil || math.Abs(*tm.Range-1) > 1e-9 {
+		t.Errorf("Expected: range 1, Got: %v\n", tm.Range)
+	}
+}
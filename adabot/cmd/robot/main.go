@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
 
 	"github.com/chzyer/readline"
@@ -19,7 +22,41 @@ func getHomeDir() string {
 	}
 	return os.Getenv("HOME")
 }
+
+// report prints an error of the evaluator, underlining where it is in the
+// input.
+func report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	if e, ok := err.(*adabot.Error); ok {
+		fmt.Fprint(os.Stderr, e.Excerpt())
+	}
+}
+
+// interruptible returns a context cancelled on ^C, which also stops the
+// robot, and the func to call once the evaluation is over.
+func interruptible(bot *adabot.Robot) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+			bot.Stop()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
 func main() {
+	sim := flag.Bool("sim", false, "drive the in-process simulator instead of the motor HAT")
+	profile := flag.String("config", "", "robot profile (YAML or JSON), defaults to the original chassis")
+	selftest := flag.Bool("selftest", false, "run the self-test, print the report and exit, nonzero on failure")
+	flag.Parse()
 
 	pi := "\xCE\xA0"
 	fmt.Printf("Come to the dork side we have %s\n", pi)
@@ -32,8 +69,56 @@ func main() {
 		panic(err)
 	}
 	defer rl.Close()
-	// New robot evaluator and start cli loop...
-	evaluator := adabot.NewEval()
+	cfg := adabot.DefaultConfig()
+	if *profile != "" {
+		if cfg, err = adabot.LoadConfig(*profile); err != nil {
+			panic(err)
+		}
+	}
+	var drive adabot.Drive
+	if *sim {
+		drive = adabot.NewSimDrive()
+	} else if drive, err = adabot.NewHatDrive(cfg); err != nil {
+		panic(err)
+	}
+	bot, err := adabot.NewRobot(drive, cfg)
+	if err != nil {
+		panic(err)
+	}
+	if *selftest {
+		report := bot.SelfTest()
+		fmt.Print(report)
+		if !report.Pass {
+			rl.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	// New robot evaluator, run the startup file, e.g. macros, if any...
+	evaluator := adabot.NewEval(bot)
+	startup := getHomeDir() + "/.gobotrc"
+	if _, err := os.Stat(startup); err == nil {
+		ctx, done := interruptible(bot)
+		if err = evaluator.RunFileContext(ctx, startup); err != nil {
+			report(err)
+		}
+		done()
+	}
+	// ...then the scripts given if any...
+	if flag.NArg() > 0 {
+		for _, path := range flag.Args() {
+			ctx, done := interruptible(bot)
+			err := evaluator.RunFileContext(ctx, path)
+			done()
+			if err != nil {
+				report(err)
+				rl.Close()
+				os.Exit(1)
+			}
+		}
+		return
+	}
+	// ...or start cli loop
 	for {
 		line, err := rl.Readline()
 		if err != nil {
@@ -43,7 +128,13 @@ func main() {
 		if line == "" {
 			continue
 		}
-		// evaluate and control
-		evaluator.Run(line)
+		// evaluate and control, a typo is reported and the loop carries on;
+		// ^C ends a loop in progress
+		ctx, done := interruptible(bot)
+		err = evaluator.RunContext(ctx, line)
+		done()
+		if err != nil {
+			report(err)
+		}
 	}
 }
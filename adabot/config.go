@@ -0,0 +1,489 @@
+package adabot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TrackConfig maps one side of the tread chassis onto a Motor HAT DC motor.
+type TrackConfig struct {
+	// Motor is the HAT "port", 0 to 3 for M1 to M4, see Google docs wiring
+	// diagram
+	Motor int `yaml:"motor"`
+	// Invert is set when the motor is wired to drive its track backward on
+	// MotorForward.
+	Invert bool `yaml:"invert"`
+	// TicksPerMeter is the encoder count per meter of track travel.  Zero
+	// means the track has no encoder and runs open-loop.  The encoder pins
+	// are polled, so at track_speed it may not tick faster than 1000/s.
+	TicksPerMeter float64 `yaml:"ticks_per_meter"`
+	// EncoderPin is the Pi header pin the encoder output is wired to.
+	EncoderPin string `yaml:"encoder_pin"`
+}
+
+// RangeConfig describes the forward facing distance sensor.
+type RangeConfig struct {
+	// Sensor is "hcsr04" for an HC-SR04 ultrasonic sensor on the GPIO pins,
+	// "lidarlite" for a Garmin LIDAR-Lite on the I2C bus, or empty when no
+	// sensor is fitted.
+	Sensor     string `yaml:"sensor"`
+	TriggerPin string `yaml:"trigger_pin"`
+	EchoPin    string `yaml:"echo_pin"`
+	// Stop is the distance (in m) to an obstacle ahead below which forward
+	// motion is blocked.
+	Stop float64 `yaml:"stop"`
+}
+
+// IMUConfig describes the inertial measurement unit.
+type IMUConfig struct {
+	// Sensor is "mpu6050" for an MPU6050 on the I2C bus, or empty when no
+	// IMU is fitted.
+	Sensor string `yaml:"sensor"`
+	// Weight is the share of a heading change measured by the IMU rather
+	// than the tracks, 0 to 1.
+	Weight float64 `yaml:"weight"`
+}
+
+// BatteryConfig describes the battery monitor and what to do as the battery
+// runs down.
+type BatteryConfig struct {
+	// Monitor is "ads1015" for an ADS1015 ADC on the I2C bus, or empty when
+	// no monitor is fitted.
+	Monitor string `yaml:"monitor"`
+	// VoltageChannel is the ADC input of the battery voltage divider, whose
+	// Divider is the battery voltage over the ADC input voltage.
+	VoltageChannel int     `yaml:"voltage_channel"`
+	Divider        float64 `yaml:"divider"`
+	// CurrentChannel is the ADC input of the motor current sensor, which
+	// outputs 1V per AmpsPerVolt.  Zero AmpsPerVolt means no current sensor.
+	CurrentChannel int     `yaml:"current_channel"`
+	AmpsPerVolt    float64 `yaml:"amps_per_volt"`
+	// Empty and Full are the battery voltages (in V) at no and full charge.
+	Empty float64 `yaml:"empty"`
+	Full  float64 `yaml:"full"`
+	// Below the Low charge, 0 to 1, the track power is limited to LowPower.
+	// Below the Cutoff charge motion is refused.
+	Low      float64 `yaml:"low"`
+	LowPower float64 `yaml:"low_power"`
+	Cutoff   float64 `yaml:"cutoff"`
+}
+
+// StepperConfig describes a stepper motor on the Motor HAT, e.g. driving a
+// turret or a lift.
+type StepperConfig struct {
+	// Port is the stepper port of the HAT: 0 drives its coils off the DC
+	// motor 0 and 1 outputs, 1 off the DC motor 2 and 3 outputs.
+	Port int `yaml:"port"`
+	// StepsPerRev is the full step count per revolution of the motor, 200
+	// for a 1.8deg stepper.  Zero means no stepper is fitted.
+	StepsPerRev int `yaml:"steps_per_rev"`
+	// RPM is the speed of a Step that does not give one.
+	RPM int `yaml:"rpm"`
+}
+
+// Actuator types, see ActuatorConfig.
+const (
+	ActuatorDC      = "dc"
+	ActuatorServo   = "servo"
+	ActuatorStepper = "stepper"
+)
+
+// ActuatorConfig declares an actuator beyond the tracks, the camera pod and
+// the stepper, e.g. a gripper, addressed by the name it is declared under.
+type ActuatorConfig struct {
+	// Type is ActuatorDC for a Motor HAT DC motor, ActuatorServo for a
+	// servo or ActuatorStepper for a Motor HAT stepper.
+	Type string `yaml:"type"`
+	// Channel is the DC motor, the servo channel or the stepper port.
+	Channel int `yaml:"channel"`
+	// Min and Max are the soft limits of the value the actuator is set to:
+	// the power of a DC motor, -1 to 1 when both are zero, the angle of a
+	// servo (in deg), or the position of a stepper (in steps), unlimited
+	// when both are zero.
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+	// Invert is set when the actuator is wired to turn the other way.
+	Invert bool `yaml:"invert"`
+	// StepsPerRev and RPM describe a stepper, see StepperConfig.
+	StepsPerRev int `yaml:"steps_per_rev"`
+	RPM         int `yaml:"rpm"`
+}
+
+// PIDConfig holds the gains of a PID controller.
+type PIDConfig struct {
+	Kp float64 `yaml:"kp"`
+	Ki float64 `yaml:"ki"`
+	Kd float64 `yaml:"kd"`
+}
+
+// ServoConfig maps one camera pod axis onto a Servo HAT channel.
+type ServoConfig struct {
+	Channel byte `yaml:"channel"`
+	// Min and Max are the soft limits of the axis (in deg).
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+	// MaxVel (in deg/s) and MaxAccel (in deg/s^2) shape the motion toward a
+	// new angle.  Zero MaxVel jumps straight there, zero MaxAccel moves at
+	// MaxVel without ramping.
+	MaxVel   float64 `yaml:"max_vel"`
+	MaxAccel float64 `yaml:"max_accel"`
+}
+
+// center returns the angle halfway between the soft limits.
+func (s ServoConfig) center() int {
+	return (s.Min + s.Max) / 2
+}
+
+// Config describes the build of a robot chassis.  It is normally loaded
+// from a YAML (or JSON) robot profile with LoadConfig.
+type Config struct {
+	Left  TrackConfig `yaml:"left"`
+	Right TrackConfig `yaml:"right"`
+	Yaw   ServoConfig `yaml:"yaw"`
+	Pitch ServoConfig `yaml:"pitch"`
+
+	// SlewRate limits how fast the track power may change, in full speed
+	// per second, so that 4 ramps from stop to full speed in 0.25s.  Zero
+	// changes speed instantly.
+	SlewRate float64 `yaml:"slew_rate"`
+	// Watchdog is the deadman timeout in seconds: the treads stop when no
+	// drive command or keepalive arrives within it.  Zero disables it.
+	Watchdog float64 `yaml:"watchdog"`
+	// Wheelbase is the distance between the middle of the two tracks (in
+	// m).  TrackSpeed calibrates the speed of a track at full power (in
+	// m/s).  Together they dead reckon the pose of the chassis.
+	Wheelbase  float64 `yaml:"wheelbase"`
+	TrackSpeed float64 `yaml:"track_speed"`
+	// SpeedPID regulates the speed of tracks fitted with encoders, in track
+	// power per m/s of speed error.
+	SpeedPID PIDConfig `yaml:"speed_pid"`
+	// Range is the sensor that keeps the robot from driving into obstacles.
+	Range RangeConfig `yaml:"range"`
+	// IMU measures the turns of the robot better than its slipping tracks.
+	IMU IMUConfig `yaml:"imu"`
+	// Battery warns of a dying battery before it ends a run.
+	Battery BatteryConfig `yaml:"battery"`
+	// Stepper is an extra actuator sharing the Motor HAT with the tracks.
+	Stepper StepperConfig `yaml:"stepper"`
+	// Actuators declares more actuators by name.  The tracks, the camera
+	// pod and the stepper are built in as left_track, right_track, yaw,
+	// pitch and stepper.  The names of commands, e.g. pan, are taken too.
+	Actuators map[string]ActuatorConfig `yaml:"actuators"`
+
+	// MotorHatAddr is the I2C address of the DC/Stepper Motor HAT.
+	MotorHatAddr int `yaml:"motor_hat_addr"`
+	// ServoHatAddr is the I2C address of a Servo HAT, e.g. 0x41 when it is
+	// stacked on top of the Motor HAT.  Zero means no Servo HAT is fitted
+	// and the servos are not initialized at startup.
+	ServoHatAddr int `yaml:"servo_hat_addr"`
+	// ServoFreq is the servo PWM frequency in Hz.
+	ServoFreq float64 `yaml:"servo_freq"`
+	// ServoMin and ServoMax are the min and max pulse lengths out of 4096.
+	ServoMin int `yaml:"servo_min"`
+	ServoMax int `yaml:"servo_max"`
+	// MaxDegree limits the max a servo can rotate (in deg).
+	MaxDegree int `yaml:"max_degree"`
+	// DegIncrease is the number of degrees to rotate per Yaw or Pitch call.
+	DegIncrease int `yaml:"deg_increase"`
+}
+
+// DefaultConfig returns the configuration of the original chassis: the
+// port track on motor 3 and the starboard track on motor 2, both wired
+// flipped, on a Motor HAT at its default address.  The battery is a 2S
+// LiPo read through a 3:1 divider.
+func DefaultConfig() *Config {
+	return &Config{
+		Left:         TrackConfig{Motor: 3, Invert: true},
+		Right:        TrackConfig{Motor: 2, Invert: true},
+		SlewRate:     4,
+		Watchdog:     1,
+		Wheelbase:    0.14,
+		TrackSpeed:   0.35,
+		SpeedPID:     PIDConfig{Kp: 1, Ki: 20},
+		Range:        RangeConfig{Stop: 0.2},
+		IMU:          IMUConfig{Weight: 0.98},
+		Battery:      BatteryConfig{Divider: 3, CurrentChannel: 1, Empty: 6.6, Full: 8.4, Low: 0.2, LowPower: 0.5, Cutoff: 0.05},
+		Stepper:      StepperConfig{RPM: 30},
+		Actuators:    map[string]ActuatorConfig{},
+		Yaw:          ServoConfig{Channel: 1, Min: 0, Max: 180, MaxVel: 120, MaxAccel: 360},
+		Pitch:        ServoConfig{Channel: 2, Min: 0, Max: 180, MaxVel: 120, MaxAccel: 360},
+		MotorHatAddr: 0x60,
+		ServoFreq:    60,
+		ServoMin:     150,
+		ServoMax:     700,
+		MaxDegree:    180,
+		DegIncrease:  10,
+	}
+}
+
+// LoadConfig reads the robot profile at path over the DefaultConfig, so a
+// profile need only list what differs from the original chassis, then
+// validates the result.
+func LoadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err = yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration against what the Adafruit HATs accept.
+func (c *Config) Validate() error {
+	for _, t := range []struct {
+		name  string
+		track TrackConfig
+	}{{"left", c.Left}, {"right", c.Right}} {
+		if t.track.Motor < 0 || t.track.Motor > 3 {
+			return fmt.Errorf("%s track: motor %d not in 0-3", t.name, t.track.Motor)
+		}
+		if t.track.TicksPerMeter < 0 {
+			return fmt.Errorf("%s track: ticks_per_meter %g must not be negative", t.name,
+				t.track.TicksPerMeter)
+		}
+		if rate := t.track.TicksPerMeter * c.TrackSpeed; rate > maxTickRate {
+			return fmt.Errorf("%s track: %g ticks/s at track_speed, the encoder poll counts %g at most",
+				t.name, rate, maxTickRate)
+		}
+	}
+	if (c.Left.TicksPerMeter > 0) != (c.Right.TicksPerMeter > 0) {
+		return fmt.Errorf("encoders must be fitted to both tracks or neither")
+	}
+	if c.Left.Motor == c.Right.Motor {
+		return fmt.Errorf("left and right tracks share motor %d", c.Left.Motor)
+	}
+	if c.SlewRate < 0 {
+		return fmt.Errorf("slew_rate %g must not be negative", c.SlewRate)
+	}
+	if c.Watchdog < 0 {
+		return fmt.Errorf("watchdog %g must not be negative", c.Watchdog)
+	}
+	if c.Wheelbase <= 0 {
+		return fmt.Errorf("wheelbase %g must be positive", c.Wheelbase)
+	}
+	if c.TrackSpeed <= 0 {
+		return fmt.Errorf("track_speed %g must be positive", c.TrackSpeed)
+	}
+	if c.SpeedPID.Kp < 0 || c.SpeedPID.Ki < 0 || c.SpeedPID.Kd < 0 {
+		return fmt.Errorf("speed_pid gains must not be negative")
+	}
+	switch c.Range.Sensor {
+	case "", "lidarlite":
+	case "hcsr04":
+		if c.Range.TriggerPin == "" || c.Range.EchoPin == "" {
+			return fmt.Errorf("range: hcsr04 needs a trigger_pin and an echo_pin")
+		}
+	default:
+		return fmt.Errorf("range: unknown sensor %q", c.Range.Sensor)
+	}
+	if c.Range.Stop < 0 {
+		return fmt.Errorf("range: stop %g must not be negative", c.Range.Stop)
+	}
+	if c.IMU.Sensor != "" && c.IMU.Sensor != "mpu6050" {
+		return fmt.Errorf("imu: unknown sensor %q", c.IMU.Sensor)
+	}
+	if c.IMU.Weight < 0 || c.IMU.Weight > 1 {
+		return fmt.Errorf("imu: weight %g not in 0-1", c.IMU.Weight)
+	}
+	if err := c.Battery.validate(); err != nil {
+		return err
+	}
+	if c.Stepper.StepsPerRev < 0 {
+		return fmt.Errorf("stepper: steps_per_rev %d must not be negative", c.Stepper.StepsPerRev)
+	}
+	if c.Stepper.StepsPerRev > 0 {
+		if c.Stepper.Port != 0 && c.Stepper.Port != 1 {
+			return fmt.Errorf("stepper: port %d not 0 or 1", c.Stepper.Port)
+		}
+		if c.Stepper.RPM <= 0 {
+			return fmt.Errorf("stepper: rpm %d must be positive", c.Stepper.RPM)
+		}
+		for _, m := range []int{c.Left.Motor, c.Right.Motor} {
+			if m/2 == c.Stepper.Port {
+				return fmt.Errorf("stepper: port %d shares the outputs of track motor %d",
+					c.Stepper.Port, m)
+			}
+		}
+	}
+	if c.MaxDegree <= 0 {
+		return fmt.Errorf("max_degree %d must be positive", c.MaxDegree)
+	}
+	if err := c.validateActuators(); err != nil {
+		return err
+	}
+	for _, s := range []struct {
+		name  string
+		servo ServoConfig
+	}{{"yaw", c.Yaw}, {"pitch", c.Pitch}} {
+		if s.servo.Channel > 15 {
+			return fmt.Errorf("%s servo: channel %d not in 0-15", s.name, s.servo.Channel)
+		}
+		if s.servo.Min < 0 || s.servo.Max > c.MaxDegree || s.servo.Min >= s.servo.Max {
+			return fmt.Errorf("%s servo: limits %d-%d not within 0-%d", s.name,
+				s.servo.Min, s.servo.Max, c.MaxDegree)
+		}
+		if s.servo.MaxVel < 0 || s.servo.MaxAccel < 0 {
+			return fmt.Errorf("%s servo: max_vel and max_accel must not be negative", s.name)
+		}
+	}
+	if c.Yaw.Channel == c.Pitch.Channel {
+		return fmt.Errorf("yaw and pitch servos share channel %d", c.Yaw.Channel)
+	}
+	if c.MotorHatAddr < 0x03 || c.MotorHatAddr > 0x77 {
+		return fmt.Errorf("motor_hat_addr %#x not a 7-bit I2C address", c.MotorHatAddr)
+	}
+	if c.ServoHatAddr != 0 && (c.ServoHatAddr < 0x03 || c.ServoHatAddr > 0x77) {
+		return fmt.Errorf("servo_hat_addr %#x not a 7-bit I2C address", c.ServoHatAddr)
+	}
+	if c.ServoHatAddr == c.MotorHatAddr {
+		return fmt.Errorf("servo_hat_addr and motor_hat_addr are both %#x", c.MotorHatAddr)
+	}
+	// the PCA9685 prescaler covers roughly 24Hz to 1526Hz
+	if c.ServoFreq < 24 || c.ServoFreq > 1526 {
+		return fmt.Errorf("servo_freq %g not in 24-1526Hz", c.ServoFreq)
+	}
+	if c.ServoMin < 0 || c.ServoMax > 4095 || c.ServoMin >= c.ServoMax {
+		return fmt.Errorf("servo pulse range %d-%d not within 0-4095", c.ServoMin, c.ServoMax)
+	}
+	if c.DegIncrease <= 0 || c.DegIncrease > c.MaxDegree {
+		return fmt.Errorf("deg_increase %d not in 1-%d", c.DegIncrease, c.MaxDegree)
+	}
+	return nil
+}
+
+func (b *BatteryConfig) validate() error {
+	if b.Monitor != "" && b.Monitor != "ads1015" {
+		return fmt.Errorf("battery: unknown monitor %q", b.Monitor)
+	}
+	for _, ch := range []int{b.VoltageChannel, b.CurrentChannel} {
+		if ch < 0 || ch > 3 {
+			return fmt.Errorf("battery: channel %d not in 0-3", ch)
+		}
+	}
+	if b.AmpsPerVolt > 0 && b.VoltageChannel == b.CurrentChannel {
+		return fmt.Errorf("battery: voltage and current share channel %d", b.VoltageChannel)
+	}
+	if b.Divider <= 0 || b.AmpsPerVolt < 0 {
+		return fmt.Errorf("battery: divider must be positive, amps_per_volt not negative")
+	}
+	if b.Empty < 0 || b.Empty >= b.Full {
+		return fmt.Errorf("battery: empty %gV not below full %gV", b.Empty, b.Full)
+	}
+	if b.Cutoff < 0 || b.Cutoff > b.Low || b.Low > 1 {
+		return fmt.Errorf("battery: charges must be 0 <= cutoff <= low <= 1")
+	}
+	if b.LowPower <= 0 || b.LowPower > 1 {
+		return fmt.Errorf("battery: low_power %g not in 0-1", b.LowPower)
+	}
+	return nil
+}
+
+// degree2pulse maps a servo angle onto a pulse length out of 4096.
+func (c *Config) degree2pulse(deg int) int32 {
+	pulse := c.ServoMin
+	pulse += ((c.ServoMax - c.ServoMin) / c.MaxDegree) * deg
+	return int32(pulse)
+}
+
+// actuatorName matches the names an actuator may be declared under, which
+// the evaluator takes as commands.
+var actuatorName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// commands are the names of the commands, sensors and default macros of the
+// evaluator, which no actuator may take.
+var commands = func() map[Var]bool {
+	names := make(map[Var]bool)
+	for name := range NewEval(&Robot{}).env {
+		names[name] = true
+	}
+	return names
+}()
+
+// validateActuators checks the declared actuators against the built in
+// ones and each other.
+func (c *Config) validateActuators() error {
+	// outputs in use: DC motors, servo channels and stepper ports, the
+	// stepper ports driving the coils off the DC motor outputs
+	motors := map[int]string{c.Left.Motor: "left_track", c.Right.Motor: "right_track"}
+	channels := map[int]string{int(c.Yaw.Channel): "yaw", int(c.Pitch.Channel): "pitch"}
+	if c.Stepper.StepsPerRev > 0 {
+		motors[2*c.Stepper.Port] = "stepper"
+		motors[2*c.Stepper.Port+1] = "stepper"
+	}
+	names := make([]string, 0, len(c.Actuators))
+	for name := range c.Actuators {
+		names = append(names, name)
+	}
+	// report the same error every time
+	sort.Strings(names)
+	for _, name := range names {
+		a := c.Actuators[name]
+		if !actuatorName.MatchString(name) {
+			return fmt.Errorf("actuator %q: name must be lower case letters, digits and _", name)
+		}
+		switch name {
+		case "left_track", "right_track", "yaw", "pitch", "stepper":
+			return fmt.Errorf("actuator %s: built in", name)
+		}
+		if keywords[name] {
+			return fmt.Errorf("actuator %s: a keyword", name)
+		}
+		if commands[Var(name)] {
+			return fmt.Errorf("actuator %s: taken by the command of that name", name)
+		}
+		if a.Min > a.Max {
+			return fmt.Errorf("actuator %s: min %g above max %g", name, a.Min, a.Max)
+		}
+		switch a.Type {
+		case ActuatorDC:
+			if a.Channel < 0 || a.Channel > 3 {
+				return fmt.Errorf("actuator %s: motor %d not in 0-3", name, a.Channel)
+			}
+			if a.Min < -1 || a.Max > 1 {
+				return fmt.Errorf("actuator %s: limits %g to %g not within -1 to 1", name, a.Min, a.Max)
+			}
+			if other, ok := motors[a.Channel]; ok {
+				return fmt.Errorf("actuator %s: motor %d taken by %s", name, a.Channel, other)
+			}
+			motors[a.Channel] = name
+		case ActuatorServo:
+			if a.Channel < 0 || a.Channel > 15 {
+				return fmt.Errorf("actuator %s: channel %d not in 0-15", name, a.Channel)
+			}
+			if a.Min < 0 || a.Max > float64(c.MaxDegree) || a.Min >= a.Max {
+				return fmt.Errorf("actuator %s: limits %g-%g not within 0-%d", name, a.Min, a.Max,
+					c.MaxDegree)
+			}
+			if other, ok := channels[a.Channel]; ok {
+				return fmt.Errorf("actuator %s: channel %d taken by %s", name, a.Channel, other)
+			}
+			channels[a.Channel] = name
+		case ActuatorStepper:
+			if a.Channel != 0 && a.Channel != 1 {
+				return fmt.Errorf("actuator %s: port %d not 0 or 1", name, a.Channel)
+			}
+			if a.StepsPerRev <= 0 || a.RPM <= 0 {
+				return fmt.Errorf("actuator %s: steps_per_rev and rpm must be positive", name)
+			}
+			for _, m := range []int{2 * a.Channel, 2*a.Channel + 1} {
+				if other, ok := motors[m]; ok {
+					return fmt.Errorf("actuator %s: port %d shares the outputs of %s", name, a.Channel, other)
+				}
+				motors[m] = name
+			}
+		default:
+			return fmt.Errorf("actuator %s: unknown type %q", name, a.Type)
+		}
+	}
+	return nil
+}
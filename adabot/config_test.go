@@ -0,0 +1,140 @@
+package adabot
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func writeProfile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "robot-profile")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return f.Name()
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+	cfg, err := LoadConfig("profiles/default.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("Expected: %+v, Got: %+v\n", *DefaultConfig(), *cfg)
+	}
+	cfg, err = LoadConfig("profiles/stacked.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cfg.ServoHatAddr != 0x41 || cfg.Left.Motor != 3 {
+		t.Errorf("Expected: servo HAT 0x41 over the default chassis, Got: %+v\n", *cfg)
+	}
+	cfg, err = LoadConfig("profiles/encoders.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cfg.Left.TicksPerMeter != 1200 || cfg.Right.EncoderPin != "18" {
+		t.Errorf("Expected: encoders on both tracks, Got: %+v %+v\n", cfg.Left, cfg.Right)
+	}
+	cfg, err = LoadConfig("profiles/turret.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cfg.Stepper.StepsPerRev != 200 || cfg.Stepper.Port != 0 {
+		t.Errorf("Expected: a stepper on port 0, Got: %+v\n", cfg.Stepper)
+	}
+	cfg, err = LoadConfig("profiles/battery.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cfg.Battery.Monitor != "ads1015" || cfg.Battery.Cutoff != DefaultConfig().Battery.Cutoff {
+		t.Errorf("Expected: ADS1015 over the default thresholds, Got: %+v\n", cfg.Battery)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeProfile(t, `{"left": {"motor": 1, "invert": false}, "right": {"motor": 0, "invert": true}}`)
+	defer os.Remove(path)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cfg.Left.Motor != 1 || cfg.Left.Invert || cfg.Right.Motor != 0 || !cfg.Right.Invert {
+		t.Errorf("Expected: left 1, right 0 inverted, Got: %+v %+v\n", cfg.Left, cfg.Right)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	profiles := []string{
+		"left: {motor: 4}",
+		"right: {motor: -1}",
+		"right: {motor: 3}",
+		"yaw: {channel: 2}",
+		"servo_hat_addr: 0x60",
+		"servo_min: 800",
+		"servo_freq: 5",
+		"deg_increase: 0",
+		"wheelbase: 0",
+		"track_speed: -0.3",
+		"left: {motor: 3, ticks_per_meter: 1200}",
+		"{left: {motor: 3, ticks_per_meter: 3000}, right: {motor: 2, ticks_per_meter: 3000}}",
+		"speed_pid: {kp: -1}",
+		"range: {sensor: sonar}",
+		"imu: {sensor: bno055}",
+		"imu: {weight: 1.5}",
+		"battery: {monitor: ina219}",
+		"battery: {empty: 9}",
+		"battery: {cutoff: 0.5}",
+		"stepper: {port: 2, steps_per_rev: 200}",
+		"stepper: {port: 1, steps_per_rev: 200}",
+		"stepper: {steps_per_rev: 200, rpm: 0}",
+		"actuators: {yaw: {type: servo, channel: 3, max: 90}}",
+		"actuators: {Gripper: {type: servo, channel: 3, max: 90}}",
+		"actuators: {gripper: {type: servo, channel: 1, max: 90}}",
+		"actuators: {gripper: {type: servo, channel: 3, min: 90, max: 200}}",
+		"actuators: {winch: {type: dc, channel: 2}}",
+		"actuators: {winch: {type: dc, channel: 4}}",
+		"actuators: {winch: {type: dc, channel: 1, max: 2}}",
+		"actuators: {lift: {type: stepper, channel: 0, steps_per_rev: 200}}",
+		"actuators: {lift: {type: stepper, channel: 1, steps_per_rev: 200, rpm: 30}}",
+		"actuators: {gripper: {type: solenoid}}",
+		"actuators: {pan: {type: servo, channel: 5, max: 180}}",
+		"actuators: {range: {type: servo, channel: 5, max: 180}}",
+		"actuators: {w: {type: dc, channel: 1}}",
+		"actuators: {while: {type: dc, channel: 1}}",
+		"range: {sensor: hcsr04, trigger_pin: \"7\"}",
+		"no_such_key: 1",
+	}
+	for _, p := range profiles {
+		path := writeProfile(t, p)
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%q: Expected: error, Got: nil\n", p)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestNewRobotServoHatInit(t *testing.T) {
+	sim := NewSimDrive()
+	cfg, err := LoadConfig("profiles/stacked.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = NewRobot(sim, cfg); err != nil {
+		t.Fatalf(err.Error())
+	}
+	cmds := sim.Commands()
+	if len(cmds) != 3 || cmds[0].Op != SimFreq || cmds[0].Freq != 60 {
+		t.Fatalf("Expected: freq then two pulses, Got: %+v\n", cmds)
+	}
+	center := cfg.degree2pulse(90)
+	if sim.Pulse(cfg.Yaw.Channel) != center || sim.Pulse(cfg.Pitch.Channel) != center {
+		t.Errorf("Expected: both servos at %d\n", center)
+	}
+}
@@ -0,0 +1,74 @@
+package adabot
+
+import "fmt"
+
+// Direction is the run direction of a DC motor, mirroring the Adafruit
+// Motor HAT forward, backward and release states.
+type Direction int
+
+const (
+	MotorForward  Direction = iota // 0
+	MotorBackward                  // 1
+	MotorRelease                   // 2
+)
+
+func (d Direction) String() string {
+	switch d {
+	case MotorForward:
+		return "forward"
+	case MotorBackward:
+		return "backward"
+	case MotorRelease:
+		return "release"
+	}
+	return "unknown"
+}
+
+// StepStyle is the coil sequence of a stepper motor, mirroring the Adafruit
+// Motor HAT step styles.
+type StepStyle int
+
+const (
+	StepSingle     StepStyle = iota // one coil at a time
+	StepDouble                      // two coils at a time, more torque
+	StepInterleave                  // half steps alternating one and two coils
+	StepMicrostep                   // full steps as eight PWM microsteps, smoothest
+)
+
+func (s StepStyle) String() string {
+	switch s {
+	case StepSingle:
+		return "single"
+	case StepDouble:
+		return "double"
+	case StepInterleave:
+		return "interleave"
+	case StepMicrostep:
+		return "microstep"
+	}
+	return "unknown"
+}
+
+// ParseStepStyle returns the StepStyle of the given name, e.g. "double".
+func ParseStepStyle(name string) (StepStyle, error) {
+	for s := StepSingle; s <= StepMicrostep; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown step style %q", name)
+}
+
+// Drive is the motor and servo backend behind a Robot.  The Adafruit Motor
+// HAT is one implementation, the in-process simulator is another.
+type Drive interface {
+	// SetDCMotorSpeed sets the speed, 0 to 255, of the given DC motor.
+	SetDCMotorSpeed(motor int, speed int32) error
+	// RunDCMotor runs the given DC motor in the given direction.
+	RunDCMotor(motor int, dir Direction) error
+	// SetServoMotorFreq sets the PWM frequency of the servo controller.
+	SetServoMotorFreq(freq float64) error
+	// SetServoMotorPulse sets the on and off ticks, out of 4096, of the
+	// given servo channel.
+	SetServoMotorPulse(channel byte, on, off int32) error
+}
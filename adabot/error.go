@@ -0,0 +1,103 @@
+package adabot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// An Error is a parse or evaluation error located in the input of Run or
+// RunFile.
+type Error struct {
+	Pos   scanner.Position // Filename is set by RunFile
+	Msg   string
+	Line  string // the line of the input at Pos
+	Width int    // of the token or statement at fault, in runes
+	Err   error  // of the evaluation, nil for a parse error
+}
+
+func (e *Error) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Pos.Line, e.Pos.Column)
+	if e.Pos.Filename != "" {
+		pos = e.Pos.Filename + ":" + pos
+	}
+	return pos + ": " + e.Msg
+}
+
+// Unwrap returns the error of the evaluation, e.g., ErrEStop.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Excerpt returns the line of the input at the error, underlined from the
+// column of the error with a caret:
+//
+//   w(1, 2 3)
+//          ^
+func (e *Error) Excerpt() string {
+	var b strings.Builder
+	b.WriteString(e.Line)
+	b.WriteByte('\n')
+	// keep the tabs of the line so that the caret lines up
+	col := 1
+	for _, r := range e.Line {
+		if col >= e.Pos.Column {
+			break
+		}
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+		col++
+	}
+	b.WriteString(strings.Repeat(" ", e.Pos.Column-col))
+	b.WriteByte('^')
+	if e.Width > 1 {
+		b.WriteString(strings.Repeat("~", e.Width-1))
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// A source is the input of a parse, shared by its lexer and the statements
+// parsed, which build an *Error from it only once one fails.
+type source struct {
+	input string
+	once  sync.Once
+	lines []int // the offset of the start of each line, indexed once needed
+}
+
+// line returns the nth line of the input, counting from 1.
+func (src *source) line(n int) string {
+	src.once.Do(func() {
+		src.lines = []int{0}
+		for i := 0; i < len(src.input); i++ {
+			if src.input[i] == '\n' {
+				src.lines = append(src.lines, i+1)
+			}
+		}
+	})
+	if n < 1 || n > len(src.lines) {
+		return ""
+	}
+	end := len(src.input)
+	if n < len(src.lines) {
+		end = src.lines[n] - 1
+	}
+	return strings.TrimRight(src.input[src.lines[n-1]:end], "\r")
+}
+
+// errorAt returns an *Error at pos spanning the input up to offset end, or
+// the rest of the line.
+func (src *source) errorAt(pos scanner.Position, end int, msg string) *Error {
+	width := 1
+	if end > pos.Offset && end <= len(src.input) {
+		span := src.input[pos.Offset:end]
+		if i := strings.IndexByte(span, '\n'); i >= 0 {
+			span = span[:i]
+		}
+		width = utf8.RuneCountInString(span)
+	}
+	return &Error{Pos: pos, Msg: msg, Line: src.line(pos.Line), Width: width}
+}
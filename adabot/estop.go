@@ -0,0 +1,53 @@
+package adabot
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+)
+
+// ErrEStop is returned by every motion command while the e-stop is latched.
+var ErrEStop = errors.New("e-stop latched")
+
+// EStop immediately releases the DC-Motors, without ramping down, freezes
+// the servos where they stand, stops the steppers and latches: every later
+// motion command fails with ErrEStop until ResetEStop.
+func (bot *Robot) EStop() (err error) {
+	// latch before taking the locks so that a command blocked on either one
+	// sees it once it gets in
+	atomic.StoreInt32(&bot.estop, 1)
+
+	bot.mu.Lock()
+	bot.cancel()
+	if bot.dog != nil {
+		bot.dog.Stop()
+		bot.dog = nil
+	}
+	err = bot.halt()
+	if _, e := bot.releaseDC(true); e != nil && err == nil {
+		err = e
+	}
+	bot.mu.Unlock()
+
+	bot.podMu.Lock()
+	for _, s := range bot.servos {
+		s.target, s.pos, s.vel = s.deg, float64(s.deg), 0
+	}
+	bot.podMu.Unlock()
+
+	log.Printf("e-stop: latched\n")
+	return
+}
+
+// ResetEStop clears the e-stop latch.  The robot stays at rest until the
+// next motion command.
+func (bot *Robot) ResetEStop() {
+	if atomic.SwapInt32(&bot.estop, 0) == 1 {
+		log.Printf("e-stop: reset\n")
+	}
+}
+
+// EStopped reports whether the e-stop is latched.
+func (bot *Robot) EStopped() bool {
+	return atomic.LoadInt32(&bot.estop) == 1
+}
@@ -0,0 +1,103 @@
+package adabot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEStopReleasesWithoutRamp(t *testing.T) {
+	bot, sim := newSimRobotConfig(t, DefaultConfig())
+
+	bot.Forward(0, 1)
+	waitRamp(t, bot, time.Second)
+	if err := bot.EStop(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// no ramp down, both motors are released at once
+	for _, port := range []int{2, 3} {
+		if m := sim.Motor(port); m.Dir != MotorRelease {
+			t.Errorf("Expected: motor %d released, Got: %s\n", port, m.Dir)
+		}
+	}
+	sim.Reset()
+	time.Sleep(100 * time.Millisecond)
+	if cmds := sim.Commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no commands after e-stop, Got: %+v\n", cmds)
+	}
+}
+
+func TestEStopFreezesPod(t *testing.T) {
+	bot, sim := newSimRobotConfig(t, DefaultConfig())
+
+	bot.SetYaw(0)
+	time.Sleep(200 * time.Millisecond)
+	bot.EStop()
+	frozen := bot.YawAngle()
+	if frozen == 0 || frozen == 90 {
+		t.Fatalf("Expected: yaw caught mid-move, Got: %d\n", frozen)
+	}
+	sim.Reset()
+	waitPod(t, bot, time.Second)
+	if got := bot.YawAngle(); got != frozen {
+		t.Errorf("Expected: %d, Got: %d\n", frozen, got)
+	}
+	if cmds := sim.Commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no pulses after e-stop, Got: %+v\n", cmds)
+	}
+}
+
+func TestEStopRejectsUntilReset(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	bot.EStop()
+	if !bot.EStopped() {
+		t.Fatalf("Expected: latched, Got: reset\n")
+	}
+	sim.Reset()
+	for name, move := range map[string]func() error{
+		"Forward":  func() error { return bot.Forward(1, 1) },
+		"Drive":    func() error { return bot.Drive(0.5, 0.5) },
+		"Yaw":      func() error { return bot.Yaw(1) },
+		"SetPitch": func() error { return bot.SetPitch(10) },
+	} {
+		if err := move(); err != ErrEStop {
+			t.Errorf("%s: Expected: %v, Got: %v\n", name, ErrEStop, err)
+		}
+	}
+	// stopping is always allowed
+	if err := bot.Stop(); err != nil {
+		t.Errorf("Stop: Expected: nil, Got: %v\n", err)
+	}
+	for _, c := range sim.Commands() {
+		if c.Op != SimRun || c.Dir != MotorRelease {
+			t.Errorf("Expected: only releases, Got: %s %s\n", c.Op, c.Dir)
+		}
+	}
+
+	bot.ResetEStop()
+	if bot.EStopped() {
+		t.Fatalf("Expected: reset, Got: latched\n")
+	}
+	if err := bot.Forward(0, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Errorf("Expected: running, Got: %s\n", m.Dir)
+	}
+}
+
+func TestEvalEStop(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("estop")
+	e.Run("w")
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+	e.Run("reset")
+	e.Run("w")
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Errorf("Expected: running, Got: %s\n", m.Dir)
+	}
+}
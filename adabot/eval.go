@@ -2,21 +2,44 @@
 package adabot
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"os"
+	"time"
 )
 
 //!+env
 
+// A controlFunc is a Robot function with its default parameters.  Call
+// arguments, e.g., w(2, 0.5), override the defaults positionally.
 type controlFunc struct {
-	Fn    func(int) error
-	Param int
+	Fn     func(params []float64) error
+	Params []float64
 }
-type Env map[Var]controlFunc
+
+// A sensorFunc reads the Robot, the value of a call expression, e.g.,
+// range().
+type sensorFunc func() (Value, error)
+
+// An Env binds a name to a controlFunc or a sensorFunc, to a macro once
+// defined, or to the Value of a variable once assigned.
+type Env map[Var]interface{}
 
 // An Expr is an expression to command the robot
 type Expr interface {
-	eval(env Env)
+	// eval returns the value of the expression, e.g., an argument to a
+	// command or a condition.
+	eval(env Env) (Value, error)
+}
+
+// A Stmt is a statement of a sequence or a script
+type Stmt interface {
+	// exec runs the statement against the Robot of e.
+	exec(e *Eval) error
 }
 
 // Eval contains the parser to maintain the implicit interface satisfaction
@@ -25,55 +48,216 @@ type Eval struct {
 	parser parser
 	bot    *Robot
 	env    Env
+	depth  int             // of the macro calls in progress
+	out    io.Writer       // prints the value of expression statements
+	ctx    context.Context // interrupts the loops in progress
 }
 
 // A Var identifies a command variable
 type Var string
 
-func (v Var) eval(env Env) {
+func (v Var) eval(env Env) (Value, error) {
+	switch x := env[v].(type) {
+	case float64, bool, record:
+		return x, nil
+	case controlFunc, macro:
+		return nil, fmt.Errorf("%s: a command has no value", v)
+	case sensorFunc:
+		return nil, fmt.Errorf("%s: call it as %s()", v, v)
+	}
+	return nil, fmt.Errorf("%s: undefined", v)
+}
+
+// tread adapts a timed, throttled Robot tread function to a controlFunc.
+func tread(fn func(sec, throttle float64) error) func([]float64) error {
+	return func(params []float64) error { return fn(params[0], params[1]) }
 }
 
 // NewEval constructs an unexported parser object to store the Env as state.
-func NewEval() *Eval {
-	bot, err := NewRobot()
-	if err != nil {
-		log.Printf(err.Error())
+// The control functions in the Env drive the given Robot.
+func NewEval(bot *Robot) *Eval {
+	stop := func([]float64) error { return bot.Stop() }
+	yaw := func(params []float64) error { return bot.Yaw(int(params[0])) }
+	pitch := func(params []float64) error { return bot.Pitch(int(params[0])) }
+	drive := func(params []float64) error { return bot.DriveFor(params[0], params[1], params[2]) }
+	speed := func(params []float64) error { return bot.DriveAt(params[0], params[1], params[2]) }
+	move := func(params []float64) error { return bot.Move(params[0], params[1]) }
+	turn := func(params []float64) error { return bot.Rotate(params[0], params[1]) }
+	keepalive := func([]float64) error { bot.Keepalive(); return nil }
+	estop := func([]float64) error { return bot.EStop() }
+	reset := func([]float64) error { bot.ResetEStop(); return nil }
+	selftest := func([]float64) error {
+		report := bot.SelfTest()
+		log.Printf("\n%s", report)
+		if !report.Pass {
+			return fmt.Errorf("self-test failed")
+		}
+		return nil
+	}
+	var e Eval
+	wait := func(params []float64) error { return e.wait(seconds(params[0])) }
+	deg := func(rad float64) float64 { return rad * 180 / math.Pi }
+	sensors := map[Var]sensorFunc{
+		// Distance to the nearest obstacle ahead in m, +Inf when none
+		"range": func() (Value, error) { return bot.Range() },
+		// Fused heading in deg, counterclockwise: while heading() < 90 { a(0.1) }
+		"heading": func() (Value, error) { return deg(bot.Heading()), nil },
+		// Dead reckoned pose in m and deg: pose().x
+		"pose": func() (Value, error) {
+			p := bot.Pose()
+			return record{{"x", p.X}, {"y", p.Y}, {"heading", deg(p.Heading)}}, nil
+		},
+		// Volts, amps and charge from 0 to 1: battery().charge
+		"battery": func() (Value, error) {
+			status, err := bot.Battery()
+			if err != nil {
+				return nil, err
+			}
+			return record{{"volts", status.Volts}, {"amps", status.Amps},
+				{"charge", status.Charge}}, nil
+		},
+		// Camera pod servo angles in deg
+		"yaw_angle":   func() (Value, error) { return float64(bot.YawAngle()), nil },
+		"pitch_angle": func() (Value, error) { return float64(bot.PitchAngle()), nil },
+	}
+	step := func(params []float64) error {
+		steps, dir := int(params[0]), MotorForward
+		if steps < 0 {
+			steps, dir = -steps, MotorBackward
+		}
+		return bot.Step(steps, dir, StepStyle(params[1]), int(params[2]))
 	}
 	env := Env{
-		// Robot control function map: WASD for treads, IJKL for camera pod
-		"w":  controlFunc{Fn: bot.Forward, Param: 1},
-		"ww": controlFunc{Fn: bot.Forward, Param: 3},
-		"a":  controlFunc{Fn: bot.Left, Param: 1},
-		"aa": controlFunc{Fn: bot.Left, Param: 3},
-		"s":  controlFunc{Fn: bot.Backward, Param: 1},
-		"ss": controlFunc{Fn: bot.Backward, Param: 3},
-		"d":  controlFunc{Fn: bot.Right, Param: 1},
-		"dd": controlFunc{Fn: bot.Right, Param: 3},
-		"j":  controlFunc{Fn: bot.Yaw, Param: -1},
-		"l":  controlFunc{Fn: bot.Yaw, Param: 1},
-		"k":  controlFunc{Fn: bot.Pitch, Param: -1},
-		"i":  controlFunc{Fn: bot.Pitch, Param: 1},
+		// Robot control function map, bound to keys by the macro library.
+		// Tread params are the move duration in seconds then the throttle.
+		"forward":  controlFunc{Fn: tread(bot.Forward), Params: []float64{1, 1}},
+		"backward": controlFunc{Fn: tread(bot.Backward), Params: []float64{1, 1}},
+		"left":     controlFunc{Fn: tread(bot.Left), Params: []float64{1, 1}},
+		"right":    controlFunc{Fn: tread(bot.Right), Params: []float64{1, 1}},
+		"stop":     controlFunc{Fn: stop},
+		// Step the camera pod servos by deg_increase, signed: pan(-1), tilt(1)
+		"pan":  controlFunc{Fn: yaw, Params: []float64{1}},
+		"tilt": controlFunc{Fn: pitch, Params: []float64{1}},
+
+		// Signed left and right track power, -1 to 1, then seconds: drive(0.4, 0.8, 2)
+		"drive": controlFunc{Fn: drive, Params: []float64{0, 0, 0}},
+		// Signed left and right track speed in m/s, then seconds: speed(0.3, 0.3, 2)
+		"speed": controlFunc{Fn: speed, Params: []float64{0, 0, 0}},
+		// Meters to drive, degrees to turn counterclockwise, then the throttle;
+		// both return once there: move(0.5), turn(-90)
+		"move": controlFunc{Fn: move, Params: []float64{0, 0.5}},
+		"turn": controlFunc{Fn: turn, Params: []float64{0, 0.5}},
+		// Feed the watchdog while an open-ended drive is running
+		"keepalive": controlFunc{Fn: keepalive},
+		// Signed stepper steps, the step style (0 single, 1 double,
+		// 2 interleave, 3 microstep) then the RPM, 0 for the configured one;
+		// returns once done: step(-50, 1)
+		"step": controlFunc{Fn: step, Params: []float64{0, 0, 0}},
+		// Pause a script or sequence, once the move before is over, cut short
+		// by the e-stop or ^C: wait(0.5)
+		"wait": controlFunc{Fn: wait, Params: []float64{1}},
+		// Exercise every actuator and sensor, then print the report
+		"selftest": controlFunc{Fn: selftest},
+		// Latch the e-stop, every motion command fails until it is reset
+		"estop": controlFunc{Fn: estop},
+		"reset": controlFunc{Fn: reset},
+	}
+	for name, fn := range sensors {
+		env[name] = fn
 	}
 	p := parser{}
-	e := Eval{env: env, parser: p}
+	e = Eval{env: env, parser: p, bot: bot, out: os.Stdout, ctx: context.Background()}
+	prog, err := e.parser.ParseScript(library)
+	if err != nil {
+		panic(fmt.Sprintf("macro library: %s", err.Error()))
+	}
+	if err = prog.exec(&e); err != nil {
+		panic(fmt.Sprintf("macro library: %s", err.Error()))
+	}
+	// Every actuator by name, e.g. yaw(45) or gripper(0.5), see Actuate.
+	// Bare, the servos center, the motors stop and the steppers go home.
+	for name, a := range bot.actuators {
+		if _, ok := env[Var(name)]; ok {
+			log.Printf("actuator %s: hidden by the command of that name\n", name)
+			continue
+		}
+		name := name
+		actuate := func(params []float64) error { return bot.Actuate(name, params[0]) }
+		env[Var(name)] = controlFunc{Fn: actuate, Params: []float64{a.home}}
+	}
 	return &e
 }
 
-// Run parses the given string expression then retrieves and executes the
-// accepted Robot function if any.
-func (e *Eval) Run(input string) {
-	// parse
-	expr, err := e.parser.Parse(input)
+// Run parses the given statements, e.g., w; d; w, then executes the
+// accepted Robot functions in order, each once the timed move of the one
+// before is over, and prints the value of the other expressions, e.g.,
+// range().  Run returns as soon as the last one is issued, or with the
+// first error, an *Error locating it in the input, if any.
+func (e *Eval) Run(input string) error {
+	return e.RunContext(context.Background(), input)
+}
+
+// RunContext is Run, its loops ending with the error of ctx once it is
+// done, e.g. cancelled on ^C.
+func (e *Eval) RunContext(ctx context.Context, input string) error {
+	prog, err := e.parser.ParseScript(input)
+	if err != nil {
+		return err
+	}
+	e.ctx = ctx
+	defer func() { e.ctx = context.Background() }()
+	return prog.exec(e)
+}
+
+// RunFile runs the .gobot script at path top to bottom, then waits for its
+// last timed move to be over.  It stops at the first statement that fails.
+func (e *Eval) RunFile(path string) error {
+	return e.RunFileContext(context.Background(), path)
+}
+
+// RunFileContext is RunFile, its loops ending with the error of ctx once it
+// is done.
+func (e *Eval) RunFileContext(ctx context.Context, path string) error {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(fmt.Sprintf("unsupported expression: %s. [Error: %s]",
-			input, err.Error()))
+		return err
 	}
-	// type assertion, retrieve the accepted Robot functions from the Env
-	controlFunc, ok := e.env[expr.(Var)]
-	if ok {
-		err = controlFunc.Fn(controlFunc.Param)
-		if err != nil {
-			log.Printf("%s\n", err.Error())
+	prog, err := e.parser.parseFile(path, string(content))
+	if err != nil {
+		return err
+	}
+	e.ctx = ctx
+	defer func() { e.ctx = context.Background() }()
+	err = prog.exec(e)
+	e.bot.WaitMove()
+	return err
+}
+
+// wait pauses for d, polling the e-stop every rampTick, and returns early
+// once interrupted, see interrupted.
+func (e *Eval) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(rampTick)
+	defer ticker.Stop()
+	for {
+		if err := e.interrupted(); err != nil {
+			return err
 		}
+		select {
+		case <-timer.C:
+			return nil
+		case <-e.ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// interrupted returns why a loop must end before its next iteration, if
+// it must: the e-stop is latched or the context of the run is done.
+func (e *Eval) interrupted() error {
+	if e.bot.EStopped() {
+		return ErrEStop
 	}
+	return e.ctx.Err()
 }
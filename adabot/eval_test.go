@@ -0,0 +1,412 @@
+package adabot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRunCallOverridesParams(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("w(0, 0.5)")
+	for _, port := range []int{2, 3} {
+		if m := sim.Motor(port); m.Speed != 128 || m.Dir == MotorRelease {
+			t.Errorf("Expected: motor %d running at 128, Got: %d %s\n", port, m.Speed, m.Dir)
+		}
+	}
+	e.Run("x")
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+}
+
+func TestRunBareUsesDefaults(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("d")
+	defer bot.Stop()
+	if m := sim.Motor(2); m.Speed != 255 || m.Dir != MotorForward {
+		t.Errorf("Expected: 255 forward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+}
+
+func TestRunStep(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Stepper = StepperConfig{StepsPerRev: 200, RPM: 600}
+	bot, sim := newSimRobotConfig(t, cfg)
+	e := NewEval(bot)
+
+	e.Run("step(-4, 1)")
+	if steps := stepCommands(sim); len(steps) != 4 || steps[0].Dir != MotorBackward ||
+		steps[0].Style != StepDouble {
+		t.Errorf("Expected: 4 double steps backward, Got: %+v\n", steps)
+	}
+}
+
+func TestRunArithmeticArgs(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("drive(1 / 2, -(0.5 + 0.5) / 4)")
+	defer bot.Stop()
+	// both tracks inverted
+	if m := sim.Motor(3); m.Speed != 128 || m.Dir != MotorBackward {
+		t.Errorf("Expected: 128 backward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	if m := sim.Motor(2); m.Speed != 64 || m.Dir != MotorForward {
+		t.Errorf("Expected: 64 forward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+}
+
+func TestRunTooManyArgs(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("w(1, 1, 1)")
+	if cmds := sim.Commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no commands, Got: %+v\n", cmds)
+	}
+}
+
+func TestRunSequence(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	start := time.Now()
+	e.Run("w(0.2, 0.5); wait(0.1); s(0.2, 0.5)")
+	defer bot.Stop()
+	// the first move ran its time, then the wait, before the second began
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Expected: at least 300ms, Got: %s\n", elapsed)
+	}
+	// both tracks inverted: backward runs the left one forward
+	if m := sim.Motor(3); m.Speed != 128 || m.Dir != MotorForward {
+		t.Errorf("Expected: 128 forward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	bot.WaitMove()
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release once over, Got: %s\n", m.Dir)
+	}
+}
+
+func TestRunWaitInterrupted(t *testing.T) {
+	bot, _ := newSimRobot(t)
+	e := NewEval(bot)
+	defer bot.ResetEStop()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bot.EStop()
+	}()
+	start := time.Now()
+	if err := e.Run("wait(1)"); !errors.Is(err, ErrEStop) {
+		t.Errorf("Expected: %s, Got: %v\n", ErrEStop, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected: under 500ms, Got: %s\n", elapsed)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	path := writeProfile(t, "// out and back\nw(0.1, 0.5)\n{\n  s(0.1)\n  x\n}\n")
+	defer os.Remove(path)
+	start := time.Now()
+	if err := e.RunFile(path); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected: at least 200ms, Got: %s\n", elapsed)
+	}
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+
+	// a statement that fails stops the script
+	path2 := writeProfile(t, "w(1, 1, 1); d")
+	defer os.Remove(path2)
+	n := len(sim.Commands())
+	if err := e.RunFile(path2); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+	if cmds := sim.Commands(); len(cmds) != n {
+		t.Errorf("Expected: no commands, Got: %+v\n", cmds[n:])
+	}
+	path3 := writeProfile(t, "w; {")
+	defer os.Remove(path3)
+	if err := e.RunFile(path3); err == nil {
+		t.Errorf("Expected: parse error, Got: nil\n")
+	}
+}
+
+func TestRunVariables(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("throttle = 0.25; throttle = throttle * 2")
+	if v := e.env["throttle"]; v != 0.5 {
+		t.Errorf("Expected: 0.5, Got: %v\n", v)
+	}
+	e.Run("w(0, throttle)")
+	defer bot.Stop()
+	if m := sim.Motor(3); m.Speed != 128 {
+		t.Errorf("Expected: 128, Got: %d\n", m.Speed)
+	}
+	// commands are not variables
+	e.Run("w = 2")
+	if _, ok := e.env["w"].(macro); !ok {
+		t.Errorf("Expected: w still a command, Got: %v\n", e.env["w"])
+	}
+}
+
+func TestRunControlFlow(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"n = 0; repeat 3 { n = n + 1 }", 3},
+		{"n = 0; repeat 0 { n = n + 1 }", 0},
+		{"n = 0; repeat 2.9 { repeat 2 { n = n + 1 } }", 4},
+		{"n = 1; while n < 100 { n = n * 2 }", 128},
+		{"n = 5; while false { n = 0 }", 5},
+		{"v = 2; if v > 1 { n = 1 } else { n = 2 }", 1},
+		{"v = 0; if v > 1 { n = 1 } else { n = 2 }", 2},
+		{"v = 3; if v == 1 { n = 1 } else if v == 3 { n = 3 }", 3},
+		{"n = 7; if false { n = 1 }", 7},
+		{"n = 7; if 1 { n = 1 }", 7},
+	}
+	bot, _ := newSimRobot(t)
+	for _, test := range tests {
+		e := NewEval(bot)
+		e.Run(test.input)
+		if n := e.env["n"]; n != test.want {
+			t.Errorf("%q: Expected: %g, Got: %v\n", test.input, test.want, n)
+		}
+	}
+}
+
+func TestRunRepeatMoves(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	start := time.Now()
+	e.Run("repeat 3 { w(0.1, 0.5) }")
+	bot.WaitMove()
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Expected: at least 300ms, Got: %s\n", elapsed)
+	}
+	var runs int
+	for _, cmd := range sim.Commands() {
+		if cmd.Op == SimRun && cmd.Port == 3 && cmd.Dir == MotorBackward {
+			runs++
+		}
+	}
+	if runs != 3 {
+		t.Errorf("Expected: 3 runs, Got: %d\n", runs)
+	}
+}
+
+func TestRunMacros(t *testing.T) {
+	bot, _ := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("def add(u, v = 10) { n = u + v }")
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"add(1, 2)", 3},
+		{"add(5)", 15},
+		// params shadow the variables of the same name, then are restored
+		{"u = 100; add(1, 1); n = n + u", 102},
+		{"def twice(v) { add(v, v) }; twice(4)", 8},
+		{"def count(k) { if k > 0 { n = n + 1; count(k - 1) } }; n = 0; count(5)", 5},
+	}
+	for _, test := range tests {
+		e.Run(test.input)
+		if n := e.env["n"]; n != test.want {
+			t.Errorf("%q: Expected: %g, Got: %v\n", test.input, test.want, n)
+		}
+	}
+	if _, ok := e.env["v"]; ok {
+		t.Errorf("Expected: v unbound after the calls, Got: %v\n", e.env["v"])
+	}
+	// failures leave n as it was
+	for _, input := range []string{"add()", "add(1, 2, 3)", "def loop() { loop }; loop; n = 0",
+		"def move() { n = 0 }; move", "add = 1"} {
+		e.Run(input)
+		if n := e.env["n"]; n != 5.0 {
+			t.Errorf("%q: Expected: 5, Got: %v\n", input, n)
+		}
+	}
+}
+
+func TestRunMacroLibrary(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	// the library binds the keys, a def overrides them
+	e.Run("def w(sec = 1, throttle = 1) { forward(sec, throttle / 2) }; w(0)")
+	defer bot.Stop()
+	if m := sim.Motor(3); m.Speed != 128 {
+		t.Errorf("Expected: 128, Got: %d\n", m.Speed)
+	}
+	e.Run("l")
+	if deg := bot.YawAngle(); deg != 90+bot.cfg.DegIncrease {
+		t.Errorf("Expected: %d, Got: %d\n", 90+bot.cfg.DegIncrease, deg)
+	}
+}
+
+func TestRunSensors(t *testing.T) {
+	bot, sim := newRangeRobot(t, 0.3)
+	sim.AddWall(1, -1, 1, 1)
+	e := NewEval(bot)
+	var out bytes.Buffer
+	e.out = &out
+
+	e.Run("range() > 0.99 && range() < 1.01; heading(); yaw_angle(); pitch_angle() - 10")
+	e.Run("pose(); p = pose(); p.y == pose().y; pose().x + 1")
+	want := "true\n0\n90\n80\n{x: 0, y: 0, heading: 0}\ntrue\n1\n"
+	if out.String() != want {
+		t.Errorf("Expected: %q, Got: %q\n", want, out.String())
+	}
+	// no battery monitor, range is not a command
+	out.Reset()
+	e.Run("battery()")
+	e.Run("range(1)")
+	e.Run("range = 1")
+	e.Run("def range() { w }")
+	e.Run("range")
+	if out.Len() != 0 {
+		t.Errorf("Expected: nothing printed, Got: %q\n", out.String())
+	}
+	if _, ok := e.env["range"].(sensorFunc); !ok {
+		t.Errorf("Expected: range still a sensor, Got: %v\n", e.env["range"])
+	}
+}
+
+func TestRunBatterySensor(t *testing.T) {
+	bot, _ := newBatteryRobot(t)
+	e := NewEval(bot)
+	var out bytes.Buffer
+	e.out = &out
+
+	e.Run("battery().volts; battery().charge > 0.5; battery().watts")
+	if want := "8\ntrue\n"; out.String() != want {
+		t.Errorf("Expected: %q, Got: %q\n", want, out.String())
+	}
+}
+
+func TestRunWhileRange(t *testing.T) {
+	bot, sim := newRangeRobot(t, 0.1)
+	sim.AddWall(0.5, -1, 0.5, 1)
+	e := NewEval(bot)
+
+	e.Run("while range() > 0.3 { w(0.1) }")
+	defer bot.Stop()
+	if d, _ := bot.Range(); d > 0.3 || d < 0.1 {
+		t.Errorf("Expected: stopped within 0.3m, Got: %gm\n", d)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	bot, _ := newSimRobot(t)
+	e := NewEval(bot)
+	defer bot.ResetEStop()
+
+	// the e-stop ends an endless loop
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bot.EStop()
+	}()
+	if err := e.Run("n = 0; while true { n = n + 1 }"); !errors.Is(err, ErrEStop) {
+		t.Errorf("Expected: %s, Got: %v\n", ErrEStop, err)
+	}
+	bot.ResetEStop()
+	// so does ^C
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if err := e.RunContext(ctx, "repeat 1e9 { n = n + 1 }"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %s, Got: %v\n", context.Canceled, err)
+	}
+	// both cut short a wait in the body
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bot.EStop()
+	}()
+	start := time.Now()
+	if err := e.Run("while true { wait(1) }"); !errors.Is(err, ErrEStop) {
+		t.Errorf("Expected: %s, Got: %v\n", ErrEStop, err)
+	}
+	bot.ResetEStop()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if err := e.RunContext(ctx, "repeat 3 { wait(1) }"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %s, Got: %v\n", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected: under 500ms, Got: %s\n", elapsed)
+	}
+	// and the next run is not
+	if err := e.Run("repeat 3 { n = n + 1 }"); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		excerpt string
+	}{
+		{"w(1, 2 3)", "1:8: got number 3, want ')'", "w(1, 2 3)\n       ^\n"},
+		{"w(", "1:3: unexpected end of file", "w(\n  ^\n"},
+		{"x; y = 1 +\n", "1:11: unexpected line break", "x; y = 1 +\n          ^\n"},
+		{"foo", "1:1: foo: undefined", "foo\n^~~\n"},
+		{"w(bar)", "1:1: w: bar: undefined", "w(bar)\n^~~~~~\n"},
+		{"x; w(1, 1, 1); d", "1:4: w: takes at most 2 arguments", "x; w(1, 1, 1); d\n   ^~~~~~~~~~\n"},
+		{"n = 1\nif n > 0 {\n\tn = n / 0\n}", "3:2: n: division by zero", "\tn = n / 0\n\t^~~~~~~~~\n"},
+		{"if 1 { x }", "1:1: if: want a bool, got number", "if 1 { x }\n^~~~~~~~~~\n"},
+		{"w(0x1g)", "1:3: invalid number 0x1g", "w(0x1g)\n  ^~~~\n"},
+		{"repeat 1e309 {}", "1:8: number 1e309 out of range", "repeat 1e309 {}\n       ^~~~~\n"},
+	}
+	bot, _ := newSimRobot(t)
+	for _, test := range tests {
+		e := NewEval(bot)
+		err := e.Run(test.input)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: Expected: %s, Got: %v\n", test.input, test.want, err)
+			continue
+		}
+		if excerpt := err.(*Error).Excerpt(); excerpt != test.excerpt {
+			t.Errorf("%q: Expected: %q, Got: %q\n", test.input, test.excerpt, excerpt)
+		}
+	}
+
+	// the error of the robot is kept
+	e := NewEval(bot)
+	defer bot.ResetEStop()
+	if err := e.Run("estop; w"); !errors.Is(err, ErrEStop) {
+		t.Errorf("Expected: %s, Got: %v\n", ErrEStop, err)
+	}
+	// a script error is located in its file
+	path := writeProfile(t, "x\nw(1 1)\n")
+	defer os.Remove(path)
+	if err := e.RunFile(path); err == nil || err.Error() != path+":2:5: got number 1, want ')'" {
+		t.Errorf("Expected: a parse error at %s:2:5, Got: %v\n", path, err)
+	}
+}
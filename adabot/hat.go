@@ -0,0 +1,331 @@
+package adabot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"gobot.io/x/gobot/drivers/i2c"
+	"gobot.io/x/gobot/platforms/raspi"
+)
+
+// encoderPoll is the period at which the encoder pins are sampled.  Each
+// tick must be seen high then low, so with room for the jitter of the ticker
+// the poll counts at most maxTickRate ticks/s, see Config.Validate.
+const encoderPoll = 250 * time.Microsecond
+
+// maxTickRate is the fastest encoder output counted reliably (in ticks/s).
+const maxTickRate = float64(time.Second / (4 * encoderPoll))
+
+// echoTimeout bounds the wait for an HC-SR04 echo, well past its 4m range.
+const echoTimeout = 30 * time.Millisecond
+
+// speedOfSound in air (in m/s).
+const speedOfSound = 343.0
+
+const (
+	// gyroPoll is the period at which the MPU6050 gyro is integrated.
+	gyroPoll = 5 * time.Millisecond
+	// gyroCalibration is the number of samples averaged for the gyro bias,
+	// while the robot stands still at startup.
+	gyroCalibration = 200
+	// gyroScale is the MPU6050 gyro count per deg/s at its +-250deg/s range.
+	gyroScale = 131.0
+)
+
+// hatDrive implements Drive and Stepper on the Adafruit Motor HAT of a
+// Raspberry Pi, Encoders on its GPIO pins, Ranger on either, and IMU and
+// Battery on the I2C bus.
+type hatDrive struct {
+	adafruit *i2c.AdafruitMotorHatDriver
+	pi       *raspi.Adaptor
+	rangeCfg RangeConfig
+	lidar    *i2c.LIDARLiteDriver
+	gyro     *i2c.MPU6050Driver
+	adc      *i2c.ADS1x15Driver
+	battery  BatteryConfig
+
+	mu     sync.Mutex
+	dirs   map[int]Direction // last direction each DC motor was run
+	ticks  map[int]int64     // encoder count of each DC motor with an encoder
+	turned float64           // integrated gyro turn (in rad)
+	imuErr error             // why the gyro stopped being integrated
+}
+
+// NewHatDrive connects to the Raspberry Pi and starts the Adafruit Motor HAT
+// driver at the I2C addresses given in cfg.  A nil cfg uses DefaultConfig.
+func NewHatDrive(cfg *Config) (Drive, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	// Now in gobot.io 1.0: Metal Gobot
+	// 	when you want to use the individual Gobot packages yourself to have the
+	//  greatest control, or to more easily integrate Gobot functionality into
+	//  your existing Golang programs.
+	r := raspi.NewAdaptor()
+	if err := r.Connect(); err != nil {
+		return nil, err
+	}
+	adaFruit := i2c.NewAdafruitMotorHatDriver(r)
+
+	// update the I2C address state before Start opens the connections
+	adaFruit.SetMotorHatAddress(cfg.MotorHatAddr)
+	if cfg.ServoHatAddr != 0 {
+		// e.g. 0x41 rather than the default 0x40 when a Servo HAT is stacked
+		// on top of a DC/Stepper Motor HAT on top of the Pi.
+		adaFruit.SetServoHatAddress(cfg.ServoHatAddr)
+	}
+	if err := adaFruit.Start(); err != nil {
+		return nil, err
+	}
+	h := &hatDrive{
+		adafruit: adaFruit,
+		pi:       r,
+		rangeCfg: cfg.Range,
+		dirs:     make(map[int]Direction),
+		ticks:    make(map[int]int64),
+	}
+	if cfg.Range.Sensor == "lidarlite" {
+		h.lidar = i2c.NewLIDARLiteDriver(r)
+		if err := h.lidar.Start(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Battery.Monitor == "ads1015" {
+		h.adc = i2c.NewADS1015Driver(r)
+		h.battery = cfg.Battery
+		if err := h.adc.Start(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.IMU.Sensor == "mpu6050" {
+		h.gyro = i2c.NewMPU6050Driver(r)
+		if err := h.gyro.Start(); err != nil {
+			return nil, err
+		}
+		go h.integrateGyro()
+	}
+	for _, track := range []TrackConfig{cfg.Left, cfg.Right} {
+		if track.TicksPerMeter <= 0 {
+			continue
+		}
+		if track.EncoderPin == "" {
+			return nil, fmt.Errorf("motor %d: ticks_per_meter without an encoder_pin", track.Motor)
+		}
+		h.ticks[track.Motor] = 0
+		go h.countTicks(r, track.Motor, track.EncoderPin)
+	}
+	return h, nil
+}
+
+// countTicks samples the single channel encoder of a DC motor, counting
+// its rising edges in the direction the motor was last run.
+func (h *hatDrive) countTicks(r *raspi.Adaptor, motor int, pin string) {
+	ticker := time.NewTicker(encoderPoll)
+	defer ticker.Stop()
+	last := 0
+	for range ticker.C {
+		val, err := r.DigitalRead(pin)
+		if err != nil {
+			log.Printf("encoder pin %s: %s\n", pin, err.Error())
+			return
+		}
+		if val == 1 && last == 0 {
+			h.mu.Lock()
+			switch h.dirs[motor] {
+			case MotorForward:
+				h.ticks[motor]++
+			case MotorBackward:
+				h.ticks[motor]--
+			}
+			h.mu.Unlock()
+		}
+		last = val
+	}
+}
+
+// Ticks implements Encoders.
+func (h *hatDrive) Ticks(motor int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ticks, ok := h.ticks[motor]
+	if !ok {
+		return 0, fmt.Errorf("no encoder on motor %d", motor)
+	}
+	return ticks, nil
+}
+
+func (h *hatDrive) SetDCMotorSpeed(motor int, speed int32) error {
+	return h.adafruit.SetDCMotorSpeed(motor, speed)
+}
+
+func (h *hatDrive) RunDCMotor(motor int, dir Direction) error {
+	var d i2c.AdafruitDirection
+	switch dir {
+	case MotorForward:
+		d = i2c.AdafruitForward
+	case MotorBackward:
+		d = i2c.AdafruitBackward
+	default:
+		d = i2c.AdafruitRelease
+	}
+	if err := h.adafruit.RunDCMotor(motor, d); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.dirs[motor] = dir
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *hatDrive) SetServoMotorFreq(freq float64) error {
+	return h.adafruit.SetServoMotorFreq(freq)
+}
+
+func (h *hatDrive) SetServoMotorPulse(channel byte, on, off int32) error {
+	return h.adafruit.SetServoMotorPulse(channel, on, off)
+}
+
+// OneStep implements Stepper.  The HAT driver sleeps between steps for
+// whole seconds only, so a single step at a time leaves the timing to Step.
+func (h *hatDrive) OneStep(port int, dir Direction, style StepStyle) error {
+	d := i2c.AdafruitForward
+	if dir == MotorBackward {
+		d = i2c.AdafruitBackward
+	}
+	var s i2c.AdafruitStepStyle
+	switch style {
+	case StepDouble:
+		s = i2c.AdafruitDouble
+	case StepInterleave:
+		s = i2c.AdafruitInterleave
+	case StepMicrostep:
+		s = i2c.AdafruitMicrostep
+	default:
+		s = i2c.AdafruitSingle
+	}
+	return h.adafruit.Step(port, 1, d, s)
+}
+
+// Probe implements Prober by reading a byte from the device.
+func (h *hatDrive) Probe(addr int) error {
+	conn, err := h.pi.GetConnection(addr, h.pi.GetDefaultBus())
+	if err != nil {
+		return err
+	}
+	// closing the connection would close the bus under the other drivers
+	_, err = conn.ReadByte()
+	return err
+}
+
+// Range implements Ranger with the sensor given in the robot profile.
+func (h *hatDrive) Range() (float64, error) {
+	switch h.rangeCfg.Sensor {
+	case "lidarlite":
+		cm, err := h.lidar.Distance()
+		if err != nil {
+			return 0, err
+		}
+		return float64(cm) / 100, nil
+	case "hcsr04":
+		return h.echoRange()
+	}
+	return 0, errors.New("no range sensor fitted")
+}
+
+// echoRange triggers an HC-SR04 and times its echo.
+func (h *hatDrive) echoRange() (float64, error) {
+	trigger, echo := h.rangeCfg.TriggerPin, h.rangeCfg.EchoPin
+	// a 10us pulse starts a measurement
+	if err := h.pi.DigitalWrite(trigger, 1); err != nil {
+		return 0, err
+	}
+	time.Sleep(10 * time.Microsecond)
+	if err := h.pi.DigitalWrite(trigger, 0); err != nil {
+		return 0, err
+	}
+	// the echo pin stays high for the round trip of the sound
+	deadline := time.Now().Add(echoTimeout)
+	var start time.Time
+	for {
+		val, err := h.pi.DigitalRead(echo)
+		if err != nil {
+			return 0, err
+		}
+		now := time.Now()
+		if start.IsZero() && val == 1 {
+			start = now
+		} else if !start.IsZero() && val == 0 {
+			return now.Sub(start).Seconds() * speedOfSound / 2, nil
+		}
+		if now.After(deadline) {
+			if start.IsZero() {
+				return 0, fmt.Errorf("hcsr04: no echo on pin %s", echo)
+			}
+			// nothing in range
+			return math.Inf(1), nil
+		}
+	}
+}
+
+// integrateGyro calibrates the MPU6050 gyro bias then integrates the yaw
+// rate, the gyro Z axis pointing up.
+func (h *hatDrive) integrateGyro() {
+	ticker := time.NewTicker(gyroPoll)
+	defer ticker.Stop()
+	var bias float64
+	n := 0
+	last := time.Now()
+	for now := range ticker.C {
+		if err := h.gyro.GetData(); err != nil {
+			h.mu.Lock()
+			h.imuErr = err
+			h.mu.Unlock()
+			return
+		}
+		z := float64(h.gyro.Gyroscope.Z)
+		if n < gyroCalibration {
+			bias += z / gyroCalibration
+			n++
+			last = now
+			continue
+		}
+		rate := (z - bias) / gyroScale * math.Pi / 180
+		h.mu.Lock()
+		h.turned += rate * now.Sub(last).Seconds()
+		h.mu.Unlock()
+		last = now
+	}
+}
+
+// Turned implements IMU.
+func (h *hatDrive) Turned() (float64, error) {
+	if h.gyro == nil {
+		return 0, errors.New("no imu fitted")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.turned, h.imuErr
+}
+
+// Voltage implements Battery.
+func (h *hatDrive) Voltage() (float64, error) {
+	if h.adc == nil {
+		return 0, errors.New("no battery monitor fitted")
+	}
+	v, err := h.adc.ReadWithDefaults(h.battery.VoltageChannel)
+	return v * h.battery.Divider, err
+}
+
+// Current implements Battery.
+func (h *hatDrive) Current() (float64, error) {
+	if h.adc == nil || h.battery.AmpsPerVolt <= 0 {
+		return 0, errors.New("no current sensor fitted")
+	}
+	v, err := h.adc.ReadWithDefaults(h.battery.CurrentChannel)
+	return v * h.battery.AmpsPerVolt, err
+}
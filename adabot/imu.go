@@ -0,0 +1,62 @@
+package adabot
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// IMU is implemented by a Drive with an inertial measurement unit.
+type IMU interface {
+	// Turned returns how far the robot turned since startup (in rad),
+	// counterclockwise positive.  It keeps counting past a full turn.
+	Turned() (float64, error)
+}
+
+// fusion holds the readings the fused heading counts from.
+type fusion struct {
+	imu float64 // IMU reading at the last ResetPose
+	odo float64 // odometry turn at the last ResetPose
+}
+
+// heading returns the fused heading (in rad): the turn measured by the IMU
+// blended by the configured weight with the turn of the tracks, which slip.
+// Without an IMU it is the odometry heading.  The caller must hold bot.mu.
+func (bot *Robot) heading(now time.Time) float64 {
+	bot.odom.advance(now)
+	if bot.imu == nil {
+		return bot.odom.pose.Heading
+	}
+	turned, err := bot.imu.Turned()
+	if err != nil {
+		log.Printf("imu: %s\n", err.Error())
+		return bot.odom.pose.Heading
+	}
+	w := bot.cfg.IMU.Weight
+	h := w*(turned-bot.fused.imu) + (1-w)*(bot.odom.turned-bot.fused.odo)
+	return math.Remainder(h, 2*math.Pi)
+}
+
+// resetHeading makes the current heading zero.  The caller must hold
+// bot.mu.
+func (bot *Robot) resetHeading() {
+	bot.fused.odo = bot.odom.turned
+	if bot.imu == nil {
+		return
+	}
+	turned, err := bot.imu.Turned()
+	if err != nil {
+		log.Printf("imu: %s\n", err.Error())
+		return
+	}
+	bot.fused.imu = turned
+}
+
+// Heading returns the heading of the robot (in rad) since it started, or
+// since ResetPose, counterclockwise positive.  With an IMU fitted it fuses
+// the IMU and the tracks, otherwise it is the Pose heading.
+func (bot *Robot) Heading() float64 {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	return bot.heading(time.Now())
+}
@@ -0,0 +1,75 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func newIMURobot(t *testing.T, weight float64) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.IMU = IMUConfig{Sensor: "mpu6050", Weight: weight}
+	return newSimRobotConfig(t, cfg)
+}
+
+func TestRotateScrubs(t *testing.T) {
+	// odometry alone, the scrubbing treads fall short of the turn
+	bot, sim := newSimRobot(t)
+	sim.SetTurnScrub(1.25)
+
+	if err := bot.Rotate(90, 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if h := sim.Pose().Heading; math.Abs(h-math.Pi/2/1.25) > 0.06 {
+		t.Errorf("Expected: %g, Got: %g\n", math.Pi/2/1.25, h)
+	}
+}
+
+func TestRotateIMU(t *testing.T) {
+	bot, sim := newIMURobot(t, 1)
+	sim.SetTurnScrub(1.25)
+
+	if err := bot.Rotate(90, 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if h := sim.Pose().Heading; math.Abs(h-math.Pi/2) > 0.06 {
+		t.Errorf("Expected: %g, Got: %g\n", math.Pi/2, h)
+	}
+	if h := bot.Heading(); math.Abs(h-sim.Pose().Heading) > 1e-3 {
+		t.Errorf("Expected: %g, Got: %g\n", sim.Pose().Heading, h)
+	}
+	// the odometry pose still believes it overshot
+	if h := bot.Pose().Heading; h < math.Pi/2+0.2 {
+		t.Errorf("Expected: past %g, Got: %g\n", math.Pi/2, h)
+	}
+}
+
+func TestHeadingFusion(t *testing.T) {
+	bot, sim := newIMURobot(t, 0.75)
+	sim.SetTurnScrub(2)
+	sim.SetGyroDrift(0.5)
+
+	bot.Left(0.2, 0.5)
+	time.Sleep(300 * time.Millisecond)
+	// the gyro turned by the truth plus its drift, the tracks twice the truth
+	truth := sim.Pose().Heading
+	gyro, _ := sim.Turned()
+	want := 0.75*gyro + 0.25*2*truth
+	if h := bot.Heading(); math.Abs(h-want) > 0.01 {
+		t.Errorf("Expected: %g, Got: %g\n", want, h)
+	}
+	bot.ResetPose()
+	if h := bot.Heading(); math.Abs(h) > 0.01 {
+		t.Errorf("Expected: 0, Got: %g\n", h)
+	}
+}
+
+func TestHeadingWithoutIMU(t *testing.T) {
+	bot, _ := newSimRobot(t)
+
+	bot.Left(0.1, 1)
+	time.Sleep(150 * time.Millisecond)
+	if h, p := bot.Heading(), bot.Pose(); h != p.Heading {
+		t.Errorf("Expected: %g, Got: %g\n", p.Heading, h)
+	}
+}
@@ -0,0 +1,87 @@
+package adabot
+
+import (
+	"fmt"
+)
+
+// maxDepth bounds the nesting of macro calls, e.g., a runaway recursion.
+const maxDepth = 64
+
+// library is the default macro library, defined by NewEval: WASD for the
+// treads, IJKL for the camera pod and x to stop.  The doubled keys drive
+// for longer.  A def in the CLI or the startup file overrides any of them.
+const library = `
+def w(sec = 1, throttle = 1) { forward(sec, throttle) }
+def ww(sec = 3, throttle = 1) { forward(sec, throttle) }
+def a(sec = 1, throttle = 1) { left(sec, throttle) }
+def aa(sec = 3, throttle = 1) { left(sec, throttle) }
+def s(sec = 1, throttle = 1) { backward(sec, throttle) }
+def ss(sec = 3, throttle = 1) { backward(sec, throttle) }
+def d(sec = 1, throttle = 1) { right(sec, throttle) }
+def dd(sec = 3, throttle = 1) { right(sec, throttle) }
+def x { stop }
+def j { pan(-1) }
+def l { pan(1) }
+def k { tilt(-1) }
+def i { tilt(1) }
+`
+
+// A param is a parameter of a macro, with its default value if any.
+type param struct {
+	name Var
+	def  Expr // nil when the argument is required
+}
+
+// A macro is a sequence of statements defined by def, called like a
+// command with arguments bound to its parameters.
+type macro struct {
+	params []param
+	body   block
+}
+
+// call runs the macro with its parameters bound to the arguments, or their
+// defaults, then restores whatever the names were bound to before.
+func (m macro) call(e *Eval, name Var, args []Value) error {
+	if len(args) > len(m.params) {
+		return fmt.Errorf("%s: takes at most %d arguments", name, len(m.params))
+	}
+	if e.depth >= maxDepth {
+		return fmt.Errorf("%s: calls nested deeper than %d", name, maxDepth)
+	}
+	values := make([]Value, len(m.params))
+	for i, p := range m.params {
+		switch {
+		case i < len(args):
+			values[i] = args[i]
+		case p.def != nil:
+			v, err := p.def.eval(e.env)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %s", name, p.name, err.Error())
+			}
+			values[i] = v
+		default:
+			return fmt.Errorf("%s: missing argument %s", name, p.name)
+		}
+	}
+	type binding struct {
+		value interface{}
+		ok    bool
+	}
+	saved := make([]binding, len(m.params))
+	for i, p := range m.params {
+		saved[i].value, saved[i].ok = e.env[p.name]
+		e.env[p.name] = values[i]
+	}
+	e.depth++
+	defer func() {
+		e.depth--
+		for i, p := range m.params {
+			if saved[i].ok {
+				e.env[p.name] = saved[i].value
+			} else {
+				delete(e.env, p.name)
+			}
+		}
+	}()
+	return m.body.exec(e)
+}
@@ -0,0 +1,209 @@
+package adabot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// ErrCancelled finishes a Move or Rotate interrupted by another command.
+var ErrCancelled = errors.New("motion cancelled")
+
+// A Motion is a Move or Rotate in progress.  It finishes once the robot has
+// covered the distance or angle, or when cancelled by Cancel or by any
+// other tread command, Stop and EStop included.  A Move forward also
+// finishes with ErrObstacle short of an obstacle.
+type Motion struct {
+	bot  *Robot
+	done chan struct{}
+	err  error
+
+	// remaining returns how far the tracks have left to go (in m)
+	remaining func(Pose) float64
+	timeout   time.Duration
+	deadline  time.Time
+}
+
+func newMotion(bot *Robot, remaining func(Pose) float64, timeout time.Duration) *Motion {
+	return &Motion{
+		bot:       bot,
+		done:      make(chan struct{}),
+		remaining: remaining,
+		timeout:   timeout,
+		deadline:  time.Now().Add(timeout),
+	}
+}
+
+// finish records the outcome and notifies the waiters.  The caller must
+// hold bot.mu.
+func (m *Motion) finish(err error) {
+	m.err = err
+	close(m.done)
+}
+
+// Done returns a channel that is closed when the motion finishes.
+func (m *Motion) Done() <-chan struct{} {
+	return m.done
+}
+
+// Err returns nil once the motion finished by reaching its goal, otherwise
+// why it did not.  It must only be called after Done is closed.
+func (m *Motion) Err() error {
+	return m.err
+}
+
+// Wait blocks until the motion finishes and returns Err.
+func (m *Motion) Wait() error {
+	<-m.done
+	return m.err
+}
+
+// Cancel stops the treads if the motion is still in progress.
+func (m *Motion) Cancel() {
+	bot := m.bot
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	if bot.motion != m {
+		return
+	}
+	bot.cancel()
+	if err := bot.release(); err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+}
+
+// brakingDistance returns how far the tracks travel (in m) while ramping
+// down from their current power.  The caller must hold bot.mu.
+func (bot *Robot) brakingDistance() float64 {
+	if bot.cfg.SlewRate <= 0 {
+		return 0
+	}
+	power := math.Max(math.Abs(bot.left.power), math.Abs(bot.right.power))
+	return power * bot.cfg.TrackSpeed * (power / bot.cfg.SlewRate) / 2
+}
+
+// startMotion drives the tracks at the given powers until the remaining
+// travel of the tracks, given the pose, comes within the braking distance.
+// It gives up after twice the time the tracks should take over dist.  The
+// caller must hold bot.mu.
+func (bot *Robot) startMotion(left, right, dist float64, remaining func(Pose) float64) (*Motion, error) {
+	if bot.EStopped() {
+		return nil, ErrEStop
+	}
+	left, right, err := bot.limitPower(left, right)
+	if err != nil {
+		return nil, err
+	}
+	if err := bot.clearAhead(left, right); err != nil {
+		return nil, err
+	}
+	bot.cancel()
+	bot.feed()
+	timeout := 2*seconds(dist/(math.Abs(left)*bot.cfg.TrackSpeed)) + time.Second
+	m := newMotion(bot, remaining, timeout)
+	if dist == 0 {
+		m.finish(nil)
+		return m, nil
+	}
+	if err := bot.setTracks(left, right); err != nil {
+		return nil, err
+	}
+	bot.motion = m
+	// the ramp goroutine checks the progress
+	bot.startRamp()
+	bot.startGuard()
+	return m, nil
+}
+
+// checkMotion stops the treads once the motion in progress is done.  It
+// is called by the ramp goroutine every rampTick after updating the pose.
+// The caller must hold bot.mu.
+func (bot *Robot) checkMotion(now time.Time) {
+	m := bot.motion
+	heading := bot.heading(now)
+	pose := bot.odom.pose
+	pose.Heading = heading
+	// stop half a tick early rather than half a tick late
+	power := math.Max(math.Abs(bot.left.power), math.Abs(bot.right.power))
+	lookahead := power * bot.cfg.TrackSpeed * rampTick.Seconds() / 2
+	var err error
+	if m.remaining(pose) > bot.brakingDistance()+lookahead {
+		if now.Before(m.deadline) {
+			return
+		}
+		err = fmt.Errorf("motion timed out after %s", m.timeout)
+	}
+	bot.motion = nil
+	bot.cancel()
+	if e := bot.release(); e != nil {
+		log.Printf("%s\n", e.Error())
+	}
+	m.finish(err)
+}
+
+// StartMove drives straight for the given distance (in m), backward when
+// negative, at the fraction of full speed given by throttle, 0 to 1.  It
+// returns at once, the Motion tells when the robot got there.
+func (bot *Robot) StartMove(meters, throttle float64) (*Motion, error) {
+	throttle = clamp01(throttle)
+	if throttle == 0 {
+		return nil, fmt.Errorf("move: throttle must be positive")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.odom.advance(time.Now())
+	start := bot.odom.pose
+	dist := math.Abs(meters)
+	sign := math.Copysign(1, meters)
+	remaining := func(p Pose) float64 {
+		along := (p.X-start.X)*math.Cos(start.Heading) + (p.Y-start.Y)*math.Sin(start.Heading)
+		return dist - sign*along
+	}
+	return bot.startMotion(sign*throttle, sign*throttle, dist, remaining)
+}
+
+// Move drives straight for the given distance (in m), see StartMove, and
+// returns once the robot got there.
+func (bot *Robot) Move(meters, throttle float64) error {
+	m, err := bot.StartMove(meters, throttle)
+	if err != nil {
+		return err
+	}
+	return m.Wait()
+}
+
+// StartRotate spins on the spot by the given angle (in deg),
+// counterclockwise when positive, at the fraction of full speed given by
+// throttle, 0 to 1.  The angle is measured by the fused Heading.  It
+// returns at once, the Motion tells when the robot got there.
+func (bot *Robot) StartRotate(degrees, throttle float64) (*Motion, error) {
+	throttle = clamp01(throttle)
+	if throttle == 0 {
+		return nil, fmt.Errorf("rotate: throttle must be positive")
+	}
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	last := bot.heading(time.Now())
+	turned := 0.0
+	// track travel to turn the chassis by the angle
+	dist := math.Abs(degrees) * math.Pi / 180 * bot.cfg.Wheelbase / 2
+	sign := math.Copysign(1, degrees)
+	remaining := func(p Pose) float64 {
+		turned += math.Remainder(p.Heading-last, 2*math.Pi)
+		last = p.Heading
+		return dist - sign*turned*bot.cfg.Wheelbase/2
+	}
+	return bot.startMotion(-sign*throttle, sign*throttle, dist, remaining)
+}
+
+// Rotate spins on the spot by the given angle (in deg), see StartRotate,
+// and returns once the robot got there.
+func (bot *Robot) Rotate(degrees, throttle float64) error {
+	m, err := bot.StartRotate(degrees, throttle)
+	if err != nil {
+		return err
+	}
+	return m.Wait()
+}
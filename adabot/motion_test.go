@@ -0,0 +1,129 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMove(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"instant": instant(DefaultConfig()),
+		"ramped":  DefaultConfig(),
+	} {
+		bot, sim := newSimRobotConfig(t, cfg)
+		if err := bot.Move(0.1, 1); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitRamp(t, bot, time.Second)
+		if p := sim.Pose(); math.Abs(p.X-0.1) > 0.01 || math.Abs(p.Heading) > 1e-3 {
+			t.Errorf("%s: Expected: 0.1m ahead, Got: %+v\n", name, p)
+		}
+		if err := bot.Move(-0.05, 1); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitRamp(t, bot, time.Second)
+		if p := sim.Pose(); math.Abs(p.X-0.05) > 0.01 {
+			t.Errorf("%s: Expected: 0.05m ahead, Got: %+v\n", name, p)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"instant": instant(DefaultConfig()),
+		"ramped":  DefaultConfig(),
+	} {
+		bot, sim := newSimRobotConfig(t, cfg)
+		if err := bot.Rotate(90, 0.5); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitRamp(t, bot, time.Second)
+		if p := sim.Pose(); math.Abs(p.Heading-math.Pi/2) > 0.08 || math.Hypot(p.X, p.Y) > 1e-3 {
+			t.Errorf("%s: Expected: a quarter turn left, Got: %+v\n", name, p)
+		}
+		// on past the half turn, where the heading wraps around
+		if err := bot.Rotate(120, 0.5); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitRamp(t, bot, time.Second)
+		want := -150 * math.Pi / 180
+		if p := sim.Pose(); math.Abs(p.Heading-want) > 0.08 {
+			t.Errorf("%s: Expected: %g, Got: %+v\n", name, want, p)
+		}
+	}
+}
+
+func TestMoveClosedLoop(t *testing.T) {
+	bot, sim := newEncoderRobot(t)
+	sim.SetMotorGain(3, 0.8)
+
+	if err := bot.Move(0.15, 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	waitRamp(t, bot, time.Second)
+	if p := sim.Pose(); math.Abs(p.X-0.15) > 0.015 || math.Abs(p.Heading) > 0.1 {
+		t.Errorf("Expected: 0.15m ahead, Got: %+v\n", p)
+	}
+}
+
+func TestMotionCancel(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	m, err := bot.StartMove(1, 0.5)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-m.Done():
+		t.Fatalf("Expected: moving, Got: done %v\n", m.Err())
+	default:
+	}
+	m.Cancel()
+	if err = m.Wait(); err != ErrCancelled {
+		t.Errorf("Expected: %v, Got: %v\n", ErrCancelled, err)
+	}
+	if mo := sim.Motor(3); mo.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", mo.Dir)
+	}
+
+	// a newer command cancels it too
+	m, _ = bot.StartRotate(90, 0.5)
+	bot.Forward(0, 0.5)
+	if err = m.Wait(); err != ErrCancelled {
+		t.Errorf("Expected: %v, Got: %v\n", ErrCancelled, err)
+	}
+	if mo := sim.Motor(3); mo.Dir != MotorBackward {
+		t.Errorf("Expected: the newer command running, Got: %s\n", mo.Dir)
+	}
+	bot.EStop()
+	if _, err = bot.StartMove(1, 1); err != ErrEStop {
+		t.Errorf("Expected: %v, Got: %v\n", ErrEStop, err)
+	}
+}
+
+func TestMoveOutlastsWatchdog(t *testing.T) {
+	bot, sim := newWatchdogRobot(t, 0.05)
+
+	if err := bot.Move(0.05, 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if p := sim.Pose(); math.Abs(p.X-0.05) > 0.01 {
+		t.Errorf("Expected: 0.05m ahead, Got: %+v\n", p)
+	}
+}
+
+func TestEvalMove(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	e := NewEval(bot)
+
+	e.Run("move(0.05)")
+	if p := sim.Pose(); math.Abs(p.X-0.05) > 0.01 {
+		t.Errorf("Expected: 0.05m ahead, Got: %+v\n", p)
+	}
+	e.Run("turn(-90, 0.3)")
+	if p := sim.Pose(); math.Abs(p.Heading+math.Pi/2) > 0.06 {
+		t.Errorf("Expected: a quarter turn right, Got: %+v\n", p)
+	}
+}
@@ -16,7 +16,7 @@ import (
 // SCALE between meters and pixels. Hardcoded to a reasonable default.
 var SCALE = 100.0
 
-// MinAreaWall suppresses noise
+// MinAreaWall suppresses noise, in square meters
 var MinAreaWall = 0.04
 var MinAreaSpace = 2.0
 
@@ -106,8 +106,25 @@ type Polygon struct {
 }
 
 // A Floorplan defines the polygons that make up a 2D floor plan representation.
+// Scale is the size in meters of a unit of the vertices, 0 for meters.
 type Floorplan struct {
 	Polygons []Polygon
+	Scale    float64 `json:",omitempty"`
+}
+
+// Meters returns the size in meters of a unit of the vertices.
+func (data *Floorplan) Meters() float64 {
+	if data.Scale == 0 {
+		return 1
+	}
+	return data.Scale
+}
+
+// IsWall reports whether p is a wall polygon larger than MinAreaWall, rather
+// than noise.
+func (data *Floorplan) IsWall(p Polygon) bool {
+	m := data.Meters()
+	return p.Layer == Wall && math.Abs(p.Area)*m*m >= MinAreaWall
 }
 
 // AddNode constructs a new Node.
@@ -285,10 +302,11 @@ func (data *Floorplan) Render(w io.Writer) {
 	minY := 1024.0 * 1024 * 1024 //math.MaxInt64
 	maxX := 0.0
 	maxY := 0.0
+	scale := SCALE * data.Meters() // pixels per unit
 	for _, p := range data.Polygons {
 		for _, v := range p.Verts {
-			x := v[0] * SCALE
-			y := v[1] * SCALE * -1 // want Y+ 2D down
+			x := v[0] * scale
+			y := v[1] * scale * -1 // want Y+ 2D down
 			minX = math.Min(minX, x)
 			minY = math.Min(minY, y)
 
@@ -323,7 +341,7 @@ func (data *Floorplan) Render(w io.Writer) {
 		switch p.Layer {
 		case Wall:
 			// Only draw wall polygons larger than 20cm x 20cm to suppress noise.
-			if math.Abs(p.Area) < MinAreaWall {
+			if !data.IsWall(p) {
 				continue
 			}
 			paint = wallP
@@ -344,14 +362,14 @@ func (data *Floorplan) Render(w io.Writer) {
 		// Draw the polygon as an SVG Path:
 		// 	M indicates MoveTo, L indicates LineTo, z indicates close path
 		// 	https://www.w3.org/TR/SVG11/paths.html#PathData
-		path := fmt.Sprintf("M %0.2f %0.2f ", p.Verts[0][0]*SCALE, p.Verts[0][1]*SCALE*-1)
+		path := fmt.Sprintf("M %0.2f %0.2f ", p.Verts[0][0]*scale, p.Verts[0][1]*scale*-1)
 
 		for i := 1; i < len(p.Verts); i++ {
 			v := p.Verts[i]
 			// NOTE: We need to flip the Y axis since the polygon data is in ProjectTango start of
 			// service frame (Y+ forward) and we want to draw image coordinates (Y+ 2D down).
-			x := int(math.Ceil(v[0] * SCALE))
-			y := int(math.Ceil(v[1] * SCALE * -1))
+			x := int(math.Ceil(v[0] * scale))
+			y := int(math.Ceil(v[1] * scale * -1))
 
 			path += fmt.Sprintf("L %d, %d ", x, y)
 		}
@@ -20,11 +20,12 @@ func (data *RawGraph) Store(netID string) error {
 	return write(data, netID)
 }
 
-// Store implements part of Storer and writes the entire plan structure to memory.
+// Store implements part of Storer and writes the entire plan structure to memory,
+// and through to the cache file so that it outlives the process.
 func (data *Floorplan) Store(planID string) error {
 	// in-memory cache
 	cache[planID] = data
-	return nil
+	return write(data, planID)
 }
 
 // Load retrieves all nodes, for the given ID, from the store.
@@ -40,14 +41,23 @@ func (data *RawGraph) Load(netID string) error {
 	return err
 }
 
-// Load retrieves the Floorplan structure from the cache if resident.
+// Load retrieves the Floorplan structure from the cache if resident, else from
+// the cache file written by Store.
 func (data *Floorplan) Load(planID string) (*Floorplan, error) {
 	if val, ok := cache[planID]; ok {
 		data = val
-		fmt.Printf("Loaded: num polygons: %d\n", len(data.Polygons))
 	} else {
-		return nil, fmt.Errorf("Store: Floorplan not in cache at ID %s", planID)
+		content, err := ioutil.ReadFile(fmt.Sprintf(cacheFile, planID))
+		if err != nil {
+			return nil, fmt.Errorf("Store: Floorplan not stored at ID %s", planID)
+		}
+		data = &Floorplan{}
+		if err = json.Unmarshal(content, data); err != nil {
+			return nil, err
+		}
+		cache[planID] = data
 	}
+	fmt.Printf("Loaded: num polygons: %d\n", len(data.Polygons))
 	return data, nil
 }
 func write(data interface{}, id string) error {
@@ -0,0 +1,94 @@
+package adabot
+
+import (
+	"math"
+	"time"
+)
+
+// Pose is a dead reckoned position on the floor: X and Y in meters from
+// where the robot started, facing along X, and Heading in radians,
+// counterclockwise positive.
+type Pose struct {
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Heading float64 `json:"heading"`
+}
+
+// odometry tracks the pose of a differential drive chassis from the travel
+// of its two tracks.
+type odometry struct {
+	wheelbase float64
+	pose      Pose
+	turned    float64   // total turn, not wrapped (in rad)
+	left      float64   // track speed since at (in m/s)
+	right     float64   // track speed since at (in m/s)
+	at        time.Time // time the pose was integrated up to
+}
+
+func newOdometry(wheelbase float64, now time.Time) odometry {
+	return odometry{wheelbase: wheelbase, at: now}
+}
+
+// travel moves the pose by the given distance of each track (in m).  The
+// chassis follows a circular arc, or a straight line, between updates.
+func (o *odometry) travel(left, right float64) {
+	dist := (left + right) / 2
+	turn := (right - left) / o.wheelbase
+	chord := dist
+	if turn != 0 {
+		chord = dist * math.Sin(turn/2) / (turn / 2)
+	}
+	dir := o.pose.Heading + turn/2
+	o.pose.X += chord * math.Cos(dir)
+	o.pose.Y += chord * math.Sin(dir)
+	o.pose.Heading = math.Remainder(o.pose.Heading+turn, 2*math.Pi)
+	o.turned += turn
+}
+
+// advance integrates the pose up to now at the current track speeds.
+func (o *odometry) advance(now time.Time) {
+	dt := now.Sub(o.at).Seconds()
+	if dt <= 0 {
+		return
+	}
+	if o.left != 0 || o.right != 0 {
+		o.travel(o.left*dt, o.right*dt)
+	}
+	o.at = now
+}
+
+// setSpeeds integrates the pose up to now then carries on at the given
+// track speeds (in m/s).
+func (o *odometry) setSpeeds(now time.Time, left, right float64) {
+	o.advance(now)
+	o.left, o.right = left, right
+}
+
+// odometer feeds the commanded power of both tracks to the pose estimate.
+// It is called whenever the power changes.  Closed-loop, regulate feeds the
+// encoder travel instead.  The caller must hold bot.mu.
+func (bot *Robot) odometer() {
+	if bot.closedLoop() {
+		return
+	}
+	bot.odom.setSpeeds(time.Now(),
+		bot.left.power*bot.cfg.TrackSpeed, bot.right.power*bot.cfg.TrackSpeed)
+}
+
+// Pose returns the dead reckoned pose of the robot.
+func (bot *Robot) Pose() Pose {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.odom.advance(time.Now())
+	return bot.odom.pose
+}
+
+// ResetPose makes the current position the origin, facing along X.  It
+// resets the fused Heading too.
+func (bot *Robot) ResetPose() {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.odom.advance(time.Now())
+	bot.odom.pose = Pose{}
+	bot.resetHeading()
+}
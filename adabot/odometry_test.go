@@ -0,0 +1,81 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOdometryTravel(t *testing.T) {
+	quarter := math.Pi / 2
+	cases := []struct {
+		name        string
+		left, right float64
+		pose        Pose
+	}{
+		{"straight", 1, 1, Pose{X: 1}},
+		{"backward", -0.5, -0.5, Pose{X: -0.5}},
+		// spinning in place sweeps the tracks around a wheelbase wide circle
+		{"spin left", -0.25 * quarter, 0.25 * quarter, Pose{Heading: quarter}},
+		// a quarter circle of radius 1 to the left
+		{"arc left", 0.75 * quarter, 1.25 * quarter, Pose{X: 1, Y: 1, Heading: quarter}},
+	}
+	for _, c := range cases {
+		o := newOdometry(0.5, time.Now())
+		o.travel(c.left, c.right)
+		if !posesClose(o.pose, c.pose, 1e-9) {
+			t.Errorf("%s: Expected: %+v, Got: %+v\n", c.name, c.pose, o.pose)
+		}
+	}
+}
+
+func posesClose(a, b Pose, tol float64) bool {
+	return math.Abs(a.X-b.X) <= tol && math.Abs(a.Y-b.Y) <= tol &&
+		math.Abs(math.Remainder(a.Heading-b.Heading, 2*math.Pi)) <= tol
+}
+
+// checkPose compares the dead reckoned pose against the simulated truth,
+// which only differs by the PWM resolution of the commanded speeds.
+func checkPose(t *testing.T, bot *Robot, sim *SimDrive) {
+	est, truth := bot.Pose(), sim.Pose()
+	if !posesClose(est, truth, 0.01) {
+		t.Errorf("Expected: %+v, Got: %+v\n", truth, est)
+	}
+}
+
+func TestPoseTracksSim(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	bot.Drive(0.5, 1)
+	time.Sleep(200 * time.Millisecond)
+	bot.Left(0, 0.7)
+	time.Sleep(100 * time.Millisecond)
+	bot.Stop()
+	checkPose(t, bot, sim)
+	if p := bot.Pose(); p.X <= 0 || p.Y <= 0 || p.Heading <= 0 {
+		t.Errorf("Expected: forward and left of the origin, Got: %+v\n", p)
+	}
+}
+
+func TestPoseTracksRamp(t *testing.T) {
+	bot, sim := newSimRobotConfig(t, DefaultConfig())
+
+	bot.Forward(0.2, 1)
+	time.Sleep(300 * time.Millisecond)
+	waitRamp(t, bot, time.Second)
+	checkPose(t, bot, sim)
+	if p := bot.Pose(); p.X <= 0 || math.Abs(p.Y) > 1e-9 {
+		t.Errorf("Expected: straight ahead, Got: %+v\n", p)
+	}
+}
+
+func TestResetPose(t *testing.T) {
+	bot, _ := newSimRobot(t)
+
+	bot.Forward(0.05, 1)
+	time.Sleep(100 * time.Millisecond)
+	bot.ResetPose()
+	if p := bot.Pose(); p != (Pose{}) {
+		t.Errorf("Expected: origin, Got: %+v\n", p)
+	}
+}
@@ -2,18 +2,90 @@ package adabot
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 // ---- lexer ----
 
 type lexer struct {
 	scan  scanner.Scanner
+	src   *source
 	token rune // current lookahead token
+	end   int  // offset just past the last token consumed
+	depth int  // parentheses open, within which line breaks are spaces
+}
+
+// The operators of two runes, scanned as one token each.  Like the
+// text/scanner tokens they are negative, so never a rune of the input.
+const (
+	opLE  rune = -(iota + 16) // <=
+	opGE                      // >=
+	opEQ                      // ==
+	opNE                      // !=
+	opAnd                     // &&
+	opOr                      // ||
+)
+
+var opNames = map[rune]string{opLE: "<=", opGE: ">=", opEQ: "==", opNE: "!=", opAnd: "&&", opOr: "||"}
+
+// opString returns the text of an operator token.
+func opString(op rune) string {
+	if s, ok := opNames[op]; ok {
+		return s
+	}
+	return string(op)
+}
+
+// keywords may not name a command or a variable.
+var keywords = map[string]bool{"repeat": true, "while": true, "if": true, "else": true, "def": true,
+	"true": true, "false": true}
+
+// newLexer returns a lexer of the input from the named file, if any, which
+// scans line breaks as tokens and skips // and /* */ comments.  Errors
+// panic, see catch.
+func newLexer(filename, input string) *lexer {
+	lex := &lexer{src: &source{input: input}}
+	lex.scan.Init(strings.NewReader(input))
+	lex.scan.Filename = filename
+	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats |
+		scanner.ScanComments | scanner.SkipComments
+	lex.scan.Whitespace ^= 1 << '\n'
+	lex.scan.Error = func(s *scanner.Scanner, msg string) { panic(lexPanic(msg)) }
+	return lex
+}
+
+func (lex *lexer) next() {
+	lex.end = lex.scan.Pos().Offset
+	lex.token = lex.scan.Scan()
+	for lex.token == '\n' && lex.depth > 0 {
+		lex.token = lex.scan.Scan()
+	}
+	switch lex.token {
+	case '(':
+		lex.depth++
+	case ')':
+		lex.depth--
+	case '<', '>', '=', '!':
+		if lex.scan.Peek() == '=' {
+			lex.scan.Next() // consume '='
+			lex.token = map[rune]rune{'<': opLE, '>': opGE, '=': opEQ, '!': opNE}[lex.token]
+		}
+	case '&', '|':
+		if lex.scan.Peek() == lex.token {
+			lex.scan.Next() // consume the second rune
+			lex.token = map[rune]rune{'&': opAnd, '|': opOr}[lex.token]
+		}
+	}
+}
+
+// keyword reports whether the current token is the given keyword.
+func (lex *lexer) keyword(kw string) bool {
+	return lex.token == scanner.Ident && lex.text() == kw
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
 
 type lexPanic string
@@ -24,7 +96,16 @@ func (lex *lexer) describe() string {
 	case scanner.EOF:
 		return "end of file"
 	case scanner.Ident:
+		if keywords[lex.text()] {
+			return fmt.Sprintf("keyword %s", lex.text())
+		}
 		return fmt.Sprintf("identifier %s", lex.text())
+	case scanner.Int, scanner.Float:
+		return fmt.Sprintf("number %s", lex.text())
+	case '\n':
+		return "line break"
+	case opLE, opGE, opEQ, opNE, opAnd, opOr:
+		return fmt.Sprintf("'%s'", opString(lex.token))
 	}
 	return fmt.Sprintf("%q", rune(lex.token)) // any other rune
 }
@@ -37,51 +118,328 @@ type parser struct {
 // Parse parses the input string as an arithmetic expression.
 //
 //   expr = num                         a literal number, e.g., 3.14159
+//        | 'true' | 'false'            a literal bool
 //        | id                          a variable name, e.g., x
 //        | id '(' expr ',' ... ')'     a function call
-//        | '-' expr                    a unary operator (+-)
+//        | expr '.' id                 a field of a record, e.g., pose().x
+//        | '-' expr                    a unary operator (+-!)
 //        | expr '+' expr               a binary operator (+-*/)
+//        | expr '<' expr               a comparison (< <= > >= == !=)
+//        | expr '&&' expr              a logical operator (&& ||)
+//        | '(' expr ')'                a parenthesized expression
+//
+// The binary operators are left associative, * and / binding tighter than
+// + and -, then the comparisons, then && and last ||.  The unary operators
+// bind tighter still.  A comparison is a bool, as are the operands of !, &&
+// and ||.
 //
 func (p *parser) Parse(input string) (_ Expr, err error) {
-	defer func() {
-		switch x := recover().(type) {
-		case nil:
-			// no panic
-		case lexPanic:
-			err = fmt.Errorf("%s", x)
-		default:
-			// unexpected panic: resume state of panic.
-			panic(x)
-		}
-	}()
-	lex := new(lexer)
-	lex.scan.Init(strings.NewReader(input))
-	lex.scan.Mode = scanner.ScanIdents
+	lex := newLexer("", input)
+	defer lex.catch(&err)
 	lex.next() // initial lookahead
 	e := p.parseExpr(lex)
 	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+		msg := fmt.Sprintf("unexpected %s", lex.describe())
+		panic(lexPanic(msg))
 	}
 	return e, nil
 }
 
-func (p *parser) parseExpr(lex *lexer) Expr {
+// ParseScript parses the input string as a sequence of statements, e.g.,
+// a line of the REPL or a whole .gobot script.
+//
+//   stmts = stmt ';' ... stmt          separated by ';' or line breaks
+//   stmt  = expr                       a command, e.g., w(2, 0.5)
+//         | id '=' expr                an assignment, e.g., speed = 0.5
+//         | '{' stmts '}'              a block
+//         | 'repeat' expr block        a loop, e.g., repeat 4 { w; a }
+//         | 'while' expr block         a loop while the expr is true
+//         | 'if' expr block            a conditional, else on the same
+//           ['else' (block | if)]      line as the closing brace
+//         | 'def' id                   a macro, e.g., def w(sec = 1) { ... }
+//           ['(' param ',' ... ')']    whose params are id ['=' expr]
+//           block
+//
+func (p *parser) ParseScript(input string) (Stmt, error) {
+	return p.parseFile("", input)
+}
+
+// parseFile parses the input read from the named file as ParseScript does.
+func (p *parser) parseFile(filename, input string) (_ Stmt, err error) {
+	lex := newLexer(filename, input)
+	defer lex.catch(&err)
+	lex.next() // initial lookahead
+	s := p.parseStmts(lex, scanner.EOF)
+	return s, nil
+}
+
+// catch turns a lexPanic into an *Error at the lookahead token, the error
+// returned by Parse.
+func (lex *lexer) catch(err *error) {
+	switch x := recover().(type) {
+	case nil:
+		// no panic
+	case lexPanic:
+		pos := lex.scan.Position
+		if !pos.IsValid() {
+			pos = lex.scan.Pos()
+		}
+		end := lex.scan.Pos().Offset
+		if lex.token == scanner.EOF || lex.token == '\n' {
+			end = pos.Offset + 1
+		}
+		*err = lex.src.errorAt(pos, end, string(x))
+	default:
+		// unexpected panic: resume state of panic.
+		panic(x)
+	}
+}
+
+// parseStmts parses statements up to the end token, EOF or '}', which it
+// leaves as the lookahead.
+func (p *parser) parseStmts(lex *lexer, end rune) block {
+	var stmts block
+	for {
+		switch lex.token {
+		case ';', '\n':
+			lex.next() // consume empty statement
+			continue
+		case end:
+			return stmts
+		}
+		pos := lex.scan.Position
+		s := p.parseStmt(lex)
+		stmts = append(stmts, located{s, lex.src, pos, lex.end})
+		if lex.token != ';' && lex.token != '\n' && lex.token != end {
+			msg := fmt.Sprintf("unexpected %s", lex.describe())
+			panic(lexPanic(msg))
+		}
+	}
+}
+
+// stmt = block | repeat | while | if | id '=' expr | expr
+func (p *parser) parseStmt(lex *lexer) Stmt {
+	switch {
+	case lex.token == '{':
+		return p.parseBlock(lex)
+	case lex.keyword("repeat"):
+		lex.next() // consume 'repeat'
+		n := p.parseExpr(lex)
+		return repeat{n, p.parseBlock(lex)}
+	case lex.keyword("while"):
+		lex.next() // consume 'while'
+		cond := p.parseExpr(lex)
+		return while{cond, p.parseBlock(lex)}
+	case lex.keyword("if"):
+		return p.parseIf(lex)
+	case lex.keyword("def"):
+		return p.parseDef(lex)
+	}
+	x := p.parseExpr(lex)
+	if v, ok := x.(Var); ok && lex.token == '=' {
+		lex.next() // consume '='
+		return assign{v, p.parseExpr(lex)}
+	}
+	return exprStmt{x}
+}
+
+// block = '{' stmts '}'
+func (p *parser) parseBlock(lex *lexer) block {
+	if lex.token != '{' {
+		msg := fmt.Sprintf("got %s, want '{'", lex.describe())
+		panic(lexPanic(msg))
+	}
+	lex.next() // consume '{'
+	b := p.parseStmts(lex, '}')
+	lex.next() // consume '}'
+	return b
+}
+
+// def = 'def' id ['(' param ',' ... ',' param ')'] block
+func (p *parser) parseDef(lex *lexer) Stmt {
+	lex.next() // consume 'def'
+	name := p.parseName(lex)
+	var params []param
+	if lex.token == '(' {
+		lex.next() // consume '('
+		if lex.token != ')' {
+			for {
+				prm := param{name: p.parseName(lex)}
+				if lex.token == '=' {
+					lex.next() // consume '='
+					prm.def = p.parseExpr(lex)
+				}
+				params = append(params, prm)
+				if lex.token != ',' {
+					break
+				}
+				lex.next() // consume ','
+			}
+			if lex.token != ')' {
+				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
+				panic(lexPanic(msg))
+			}
+		}
+		lex.next() // consume ')'
+	}
+	return define{name, macro{params, p.parseBlock(lex)}}
+}
+
+// parseName parses an identifier that is not a keyword.
+func (p *parser) parseName(lex *lexer) Var {
+	if lex.token != scanner.Ident || keywords[lex.text()] {
+		msg := fmt.Sprintf("got %s, want identifier", lex.describe())
+		panic(lexPanic(msg))
+	}
+	name := Var(lex.text())
+	lex.next() // consume Ident
+	return name
+}
+
+// if = 'if' expr block ['else' (block | if)]
+func (p *parser) parseIf(lex *lexer) Stmt {
+	lex.next() // consume 'if'
+	s := ifElse{cond: p.parseExpr(lex)}
+	s.then = p.parseBlock(lex)
+	if !lex.keyword("else") {
+		return s
+	}
+	lex.next() // consume 'else'
+	if lex.keyword("if") {
+		s.els = p.parseIf(lex)
+	} else {
+		s.els = p.parseBlock(lex)
+	}
+	return s
+}
+
+func (p *parser) parseExpr(lex *lexer) Expr { return p.parseBinary(lex, 1) }
+
+// binary = unary ('+' binary)*
+// parseBinary stops when it encounters an
+// operator of lower precedence than prec1.
+func (p *parser) parseBinary(lex *lexer, prec1 int) Expr {
+	lhs := p.parseUnary(lex)
+	for prec := precedence(lex.token); prec >= prec1; prec-- {
+		for precedence(lex.token) == prec {
+			op := lex.token
+			lex.next() // consume operator
+			rhs := p.parseBinary(lex, prec+1)
+			lhs = binary{op, lhs, rhs}
+		}
+	}
+	return lhs
+}
+
+// unary = '+' expr | primary
+func (p *parser) parseUnary(lex *lexer) Expr {
+	if lex.token == '+' || lex.token == '-' || lex.token == '!' {
+		op := lex.token
+		lex.next() // consume '+', '-' or '!'
+		return unary{op, p.parseUnary(lex)}
+	}
 	return p.parsePrimary(lex)
 }
 
-// primary = id
+// primary = operand '.' id ... '.' id
+func (p *parser) parsePrimary(lex *lexer) Expr {
+	x := p.parseOperand(lex)
+	for lex.token == '.' {
+		lex.next() // consume '.'
+		x = selector{x, string(p.parseName(lex))}
+	}
+	return x
+}
+
+// operand = id
 //         | id '(' expr ',' ... ',' expr ')'
 //         | num
+//         | 'true' | 'false'
 //         | '(' expr ')'
-func (p *parser) parsePrimary(lex *lexer) Expr {
+func (p *parser) parseOperand(lex *lexer) Expr {
 	switch lex.token {
 	case scanner.Ident:
+		if lex.keyword("true") || lex.keyword("false") {
+			b := boolean(lex.text() == "true")
+			lex.next() // consume 'true' or 'false'
+			return b
+		}
+		if keywords[lex.text()] {
+			break
+		}
 		id := lex.text()
-		lex.next() // consume Identifier
+		lex.next() // consume Ident
 		if lex.token != '(' {
 			return Var(id)
 		}
+		lex.next() // consume '('
+		var args []Expr
+		if lex.token != ')' {
+			for {
+				args = append(args, p.parseExpr(lex))
+				if lex.token != ',' {
+					break
+				}
+				lex.next() // consume ','
+			}
+			if lex.token != ')' {
+				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
+				panic(lexPanic(msg))
+			}
+		}
+		lex.next() // consume ')'
+		return call{id, args}
+
+	case scanner.Int, scanner.Float:
+		text, pos := lex.text(), lex.scan.Position
+		// the rest of a malformed number, e.g. the g of 0x1g, which would
+		// otherwise be scanned as a name
+		for {
+			r := lex.scan.Peek()
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			text += string(lex.scan.Next())
+		}
+		lex.scan.Position = pos // reported at the number, which Next forgets
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			if err.(*strconv.NumError).Err == strconv.ErrRange {
+				panic(lexPanic(fmt.Sprintf("number %s out of range", text)))
+			}
+			panic(lexPanic(fmt.Sprintf("invalid number %s", text)))
+		}
+		lex.next() // consume number
+		return literal(f)
+
+	case '(':
+		lex.next() // consume '('
+		e := p.parseExpr(lex)
+		if lex.token != ')' {
+			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
+			panic(lexPanic(msg))
+		}
+		lex.next() // consume ')'
+		return e
 	}
 	msg := fmt.Sprintf("unexpected %s", lex.describe())
 	panic(lexPanic(msg))
 }
+
+// precedence returns the binding power of a binary operator, zero for any
+// other token.
+func precedence(op rune) int {
+	switch op {
+	case '*', '/':
+		return 5
+	case '+', '-':
+		return 4
+	case '<', '>', opLE, opGE, opEQ, opNE:
+		return 3
+	case opAnd:
+		return 2
+	case opOr:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package adabot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Expr
+	}{
+		{"x", Var("x")},
+		{"3.5", literal(3.5)},
+		{"-90", unary{'-', literal(90)}},
+		{"+1", unary{'+', literal(1)}},
+		{"--1", unary{'-', unary{'-', literal(1)}}},
+		{"1 + 2", binary{'+', literal(1), literal(2)}},
+		{"1 - 2 - 3", binary{'-', binary{'-', literal(1), literal(2)}, literal(3)}},
+		{"1 + 2 * 3", binary{'+', literal(1), binary{'*', literal(2), literal(3)}}},
+		{"1 * 2 + 3", binary{'+', binary{'*', literal(1), literal(2)}, literal(3)}},
+		{"8 / 4 / 2", binary{'/', binary{'/', literal(8), literal(4)}, literal(2)}},
+		{"(1 + 2) * 3", binary{'*', binary{'+', literal(1), literal(2)}, literal(3)}},
+		{"-x * 2", binary{'*', unary{'-', Var("x")}, literal(2)}},
+		{"2 * -3", binary{'*', literal(2), unary{'-', literal(3)}}},
+		{"((x))", Var("x")},
+		{"w()", call{"w", nil}},
+		{"w(2, 0.5)", call{"w", []Expr{literal(2), literal(0.5)}}},
+		{"turn(-90 / 2)", call{"turn", []Expr{binary{'/', unary{'-', literal(90)}, literal(2)}}}},
+		{"f(g(1), (2))", call{"f", []Expr{call{"g", []Expr{literal(1)}}, literal(2)}}},
+		{"x < 1", binary{'<', Var("x"), literal(1)}},
+		{"x+1 >= 2*y", binary{opGE, binary{'+', Var("x"), literal(1)}, binary{'*', literal(2), Var("y")}}},
+		{"x == y != 0", binary{opNE, binary{opEQ, Var("x"), Var("y")}, literal(0)}},
+		{"1 <= 2", binary{opLE, literal(1), literal(2)}},
+		{"!x", unary{'!', Var("x")}},
+		{"true", boolean(true)},
+		{"a || b && !c", binary{opOr, Var("a"), binary{opAnd, Var("b"), unary{'!', Var("c")}}}},
+		{"x < 1 && y >= 2", binary{opAnd, binary{'<', Var("x"), literal(1)}, binary{opGE, Var("y"), literal(2)}}},
+		{"pose().x * 2", binary{'*', selector{call{"pose", nil}, "x"}, literal(2)}},
+		{"r.a.b", selector{selector{Var("r"), "a"}, "b"}},
+	}
+	for _, test := range tests {
+		var p parser
+		got, err := p.Parse(test.input)
+		if err != nil {
+			t.Errorf("%q: Expected: %#v, Got: %s\n", test.input, test.want, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: Expected: %#v, Got: %#v\n", test.input, test.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "1:1: unexpected end of file"},
+		{"1 +", "1:4: unexpected end of file"},
+		{"(1 + 2", "1:7: got end of file, want ')'"},
+		{"w(1, 2", "1:7: got end of file, want ')'"},
+		{"w(1 2)", "1:5: got number 2, want ')'"},
+		{"1 2", "1:3: unexpected number 2"},
+		{"* 2", "1:1: unexpected '*'"},
+		{"x y", "1:3: unexpected identifier y"},
+		{")", "1:1: unexpected ')'"},
+		{"x = 1", "1:3: unexpected '='"},
+		{"1 < = 2", "1:5: unexpected '='"},
+		{"x & y", "1:3: unexpected '&'"},
+		{"pose().", "1:8: got end of file, want identifier"},
+		{"true = 1", "1:6: unexpected '='"},
+		{"while + 1", "1:1: unexpected keyword while"},
+	}
+	for _, test := range tests {
+		var p parser
+		_, err := p.Parse(test.input)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: Expected: %s, Got: %v\n", test.input, test.want, err)
+		}
+	}
+}
+
+func TestParseScripts(t *testing.T) {
+	paths, err := filepath.Glob("scripts/*.gobot")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Expected: example scripts, Got: %v %v\n", paths, err)
+	}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var p parser
+		if _, err = p.ParseScript(string(content)); err != nil {
+			t.Errorf("%s: %s\n", path, err.Error())
+		}
+	}
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Value
+	}{
+		{"-90", -90.0},
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"1 / 4", 0.25},
+		{"-(2 - 5)", 3.0},
+		{"2 * -1.5", -3.0},
+		{"1 < 2", true},
+		{"2 < 1", false},
+		{"1 + 1 == 2", true},
+		{"2 != 2", false},
+		{"(3 >= 3) == !(3 <= 2)", true},
+		{"true && 1 > 2 || !false", true},
+		// the right operand is not evaluated, or would fail
+		{"false && x", false},
+		{"true || x", true},
+	}
+	for _, test := range tests {
+		var p parser
+		expr, err := p.Parse(test.input)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		got, err := expr.eval(nil)
+		if err != nil || got != test.want {
+			t.Errorf("%q: Expected: %v, Got: %v %v\n", test.input, test.want, got, err)
+		}
+	}
+	for _, input := range []string{"1 / 0", "x + 1", "w(1) * 2",
+		"(1 < 2) + 1", "!1", "1 && true", "-true", "1 == true", "(1).x"} {
+		var p parser
+		expr, err := p.Parse(input)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err = expr.eval(nil); err == nil {
+			t.Errorf("%q: Expected: error, Got: nil\n", input)
+		}
+	}
+}
+
+// unlocated returns the statement without the positions of its own
+// statements, to compare the parse trees.
+func unlocated(s Stmt) Stmt {
+	switch x := s.(type) {
+	case located:
+		return unlocated(x.Stmt)
+	case block:
+		if x == nil {
+			return x
+		}
+		b := make(block, len(x))
+		for i, s := range x {
+			b[i] = unlocated(s)
+		}
+		return b
+	case repeat:
+		x.body = unlocated(x.body).(block)
+		return x
+	case while:
+		x.body = unlocated(x.body).(block)
+		return x
+	case ifElse:
+		x.then = unlocated(x.then).(block)
+		if x.els != nil {
+			x.els = unlocated(x.els)
+		}
+		return x
+	case define:
+		x.m.body = unlocated(x.m.body).(block)
+		return x
+	}
+	return s
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Stmt
+	}{
+		{"", block(nil)},
+		{"w", block{exprStmt{Var("w")}}},
+		{"w; d; w", block{exprStmt{Var("w")}, exprStmt{Var("d")}, exprStmt{Var("w")}}},
+		{"w\nd\n", block{exprStmt{Var("w")}, exprStmt{Var("d")}}},
+		{";; w ;\n\n d;", block{exprStmt{Var("w")}, exprStmt{Var("d")}}},
+		{"{ w; d }; a", block{block{exprStmt{Var("w")}, exprStmt{Var("d")}}, exprStmt{Var("a")}}},
+		{"{\n  w\n  {}\n}", block{block{exprStmt{Var("w")}, block(nil)}}},
+		{"x = 1 + 2", block{assign{"x", binary{'+', literal(1), literal(2)}}}},
+		{"repeat 4 { w; a }", block{repeat{literal(4), block{exprStmt{Var("w")}, exprStmt{Var("a")}}}}},
+		{"while x < 3 {\n x = x + 1\n}", block{while{binary{'<', Var("x"), literal(3)},
+			block{assign{"x", binary{'+', Var("x"), literal(1)}}}}}},
+		{"if x { w }", block{ifElse{Var("x"), block{exprStmt{Var("w")}}, nil}}},
+		{"if x { w } else if y { s } else {}", block{ifElse{Var("x"), block{exprStmt{Var("w")}},
+			ifElse{Var("y"), block{exprStmt{Var("s")}}, block(nil)}}}},
+		{"def x { w }", block{define{"x", macro{nil, block{exprStmt{Var("w")}}}}}},
+		{"def sq(n, t = 0.5) {\n move(n, t)\n}", block{define{"sq", macro{
+			[]param{{"n", nil}, {"t", literal(0.5)}},
+			block{exprStmt{call{"move", []Expr{Var("n"), Var("t")}}}}}}}},
+		{"def f() {}", block{define{"f", macro{nil, block(nil)}}}},
+		{"w(2,\n 0.5) // forward\nwait(1) /* then */ ; d",
+			block{exprStmt{call{"w", []Expr{literal(2), literal(0.5)}}},
+				exprStmt{call{"wait", []Expr{literal(1)}}}, exprStmt{Var("d")}}},
+	}
+	for _, test := range tests {
+		var p parser
+		got, err := p.ParseScript(test.input)
+		if err != nil {
+			t.Errorf("%q: Expected: %#v, Got: %s\n", test.input, test.want, err.Error())
+			continue
+		}
+		if got = unlocated(got); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: Expected: %#v, Got: %#v\n", test.input, test.want, got)
+		}
+	}
+	for _, input := range []string{"{ w", "w }", "w d", "{ w; d } a", "w(1\n, 2",
+		"repeat 4 w", "if x { w }\nelse { s }", "1 = 2", "if = 1", "while {}",
+		"def { w }", "def if { w }", "def f(1) { w }", "def f(n,) { w }", "def f(n) w", "x = def"} {
+		var p parser
+		if _, err := p.ParseScript(input); err == nil {
+			t.Errorf("%q: Expected: error, Got: nil\n", input)
+		}
+	}
+}
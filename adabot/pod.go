@@ -0,0 +1,177 @@
+package adabot
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// podTick is the period at which the pod goroutine steps the servos.
+const podTick = 20 * time.Millisecond
+
+// servo is the state of one camera pod axis, or of a declared servo.
+type servo struct {
+	cfg    ServoConfig
+	invert bool    // mirror the angles written, 0 for MaxDegree
+	target int     // angle being moved toward (in deg)
+	pos    float64 // interpolated angle (in deg)
+	vel    float64 // angular velocity (in deg/s)
+	deg    int     // last angle written to the servo
+}
+
+func newServo(cfg ServoConfig) servo {
+	c := cfg.center()
+	return servo{cfg: cfg, target: c, pos: float64(c), deg: c}
+}
+
+// step advances the interpolated angle by dt seconds toward the target,
+// limited by the max angular velocity and acceleration of the axis, and
+// reports whether the servo is still moving.
+func (s *servo) step(dt float64) bool {
+	rem := float64(s.target) - s.pos
+	if rem == 0 && s.vel == 0 {
+		return false
+	}
+	// fastest speed from which we can still stop at the target
+	want := s.cfg.MaxVel
+	if s.cfg.MaxAccel > 0 {
+		want = math.Min(want, math.Sqrt(2*s.cfg.MaxAccel*math.Abs(rem)))
+	}
+	want = math.Copysign(want, rem)
+	if s.cfg.MaxAccel > 0 {
+		dv := s.cfg.MaxAccel * dt
+		want = math.Max(s.vel-dv, math.Min(s.vel+dv, want))
+	}
+	s.vel = want
+	move := s.vel * dt
+	// arrive rather than overshoot when heading at the target
+	if math.Abs(move) >= math.Abs(rem) && math.Signbit(move) == math.Signbit(rem) {
+		s.pos = float64(s.target)
+		s.vel = 0
+		return false
+	}
+	s.pos += move
+	return true
+}
+
+// writeServo sends the pulse for deg to the servo.  The caller must hold
+// bot.podMu.
+func (bot *Robot) writeServo(s *servo, deg int) (err error) {
+	wired := deg
+	if s.invert {
+		wired = bot.cfg.MaxDegree - deg
+	}
+	pulse := bot.cfg.degree2pulse(wired)
+	if err = bot.drive.SetServoMotorPulse(s.cfg.Channel, 0, pulse); err != nil {
+		log.Printf("%s\n", err.Error())
+		return
+	}
+	s.deg = deg
+	return
+}
+
+// setServo retargets the servo to deg, clamped to its soft limits.  Axes
+// without a max angular velocity jump straight there, the others are moved
+// smoothly by the pod goroutine.  It fails with ErrEStop while the e-stop
+// is latched.  The caller must hold bot.podMu.
+func (bot *Robot) setServo(s *servo, deg int) error {
+	if bot.EStopped() {
+		return ErrEStop
+	}
+	if deg < s.cfg.Min {
+		deg = s.cfg.Min
+	} else if deg > s.cfg.Max {
+		deg = s.cfg.Max
+	}
+	s.target = deg
+	if s.cfg.MaxVel <= 0 {
+		s.pos, s.vel = float64(deg), 0
+		return bot.writeServo(s, deg)
+	}
+	if !bot.podMoving {
+		bot.podMoving = true
+		go bot.runPod()
+	}
+	return nil
+}
+
+// runPod steps every servo every podTick until they come to rest at their
+// targets.
+func (bot *Robot) runPod() {
+	ticker := time.NewTicker(podTick)
+	defer ticker.Stop()
+	last := time.Now()
+	for now := range ticker.C {
+		dt := now.Sub(last).Seconds()
+		last = now
+
+		bot.podMu.Lock()
+		moving := false
+		for _, s := range bot.servos {
+			if s.step(dt) {
+				moving = true
+			}
+			if deg := int(math.Round(s.pos)); deg != s.deg {
+				bot.writeServo(s, deg)
+			}
+		}
+		if !moving {
+			bot.podMoving = false
+			bot.podMu.Unlock()
+			return
+		}
+		bot.podMu.Unlock()
+	}
+}
+
+// Pitch will rotate the vertical oriented servo up/down based on the sign of dir.
+func (bot *Robot) Pitch(dir int) error {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	if dir > 0 {
+		return bot.setServo(&bot.pitch, bot.pitch.target-bot.cfg.DegIncrease)
+	}
+	return bot.setServo(&bot.pitch, bot.pitch.target+bot.cfg.DegIncrease)
+}
+
+// Yaw will rotate the horizontal oriented servo left/right based on the sign of dir.
+func (bot *Robot) Yaw(dir int) error {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	if dir <= 0 {
+		// DEC
+		return bot.setServo(&bot.yaw, bot.yaw.target-bot.cfg.DegIncrease)
+	}
+	// INCR
+	return bot.setServo(&bot.yaw, bot.yaw.target+bot.cfg.DegIncrease)
+}
+
+// SetPitch rotates the vertical oriented servo to deg, clamped to its soft
+// limits.
+func (bot *Robot) SetPitch(deg int) error {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	return bot.setServo(&bot.pitch, deg)
+}
+
+// SetYaw rotates the horizontal oriented servo to deg, clamped to its soft
+// limits.
+func (bot *Robot) SetYaw(deg int) error {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	return bot.setServo(&bot.yaw, deg)
+}
+
+// PitchAngle returns the current angle of the vertical oriented servo.
+func (bot *Robot) PitchAngle() int {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	return bot.pitch.deg
+}
+
+// YawAngle returns the current angle of the horizontal oriented servo.
+func (bot *Robot) YawAngle() int {
+	bot.podMu.Lock()
+	defer bot.podMu.Unlock()
+	return bot.yaw.deg
+}
@@ -0,0 +1,130 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestServoSoftLimits(t *testing.T) {
+	cfg := instant(DefaultConfig())
+	cfg.Yaw.Min, cfg.Yaw.Max = 60, 120
+	bot, sim := newSimRobotConfig(t, cfg)
+	if got := bot.YawAngle(); got != 90 {
+		t.Errorf("Expected: 90, Got: %d\n", got)
+	}
+	for i := 0; i < 10; i++ {
+		bot.Yaw(1)
+	}
+	if got := bot.YawAngle(); got != 120 {
+		t.Errorf("Expected: 120, Got: %d\n", got)
+	}
+	if sim.Pulse(cfg.Yaw.Channel) != cfg.degree2pulse(120) {
+		t.Errorf("Expected: pulse %d, Got: %d\n", cfg.degree2pulse(120), sim.Pulse(cfg.Yaw.Channel))
+	}
+	bot.SetYaw(10)
+	if got := bot.YawAngle(); got != 60 {
+		t.Errorf("Expected: 60, Got: %d\n", got)
+	}
+}
+
+func TestServoStatePerRobot(t *testing.T) {
+	bot1, _ := newSimRobot(t)
+	bot2, _ := newSimRobot(t)
+
+	bot1.SetPitch(30)
+	bot1.Pitch(1)
+	if got := bot1.PitchAngle(); got != 20 {
+		t.Errorf("Expected: 20, Got: %d\n", got)
+	}
+	if got := bot2.PitchAngle(); got != 90 {
+		t.Errorf("Expected: 90, Got: %d\n", got)
+	}
+}
+
+// waitPod waits for the pod goroutine to bring both servos to rest.
+func waitPod(t *testing.T, bot *Robot, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		bot.podMu.Lock()
+		moving := bot.podMoving
+		bot.podMu.Unlock()
+		if !moving {
+			return
+		}
+		time.Sleep(podTick)
+	}
+	t.Fatalf("Expected: pod at rest within %s\n", timeout)
+}
+
+// yawAngles returns the yaw angles written to the servo, in order.
+func yawAngles(bot *Robot, sim *SimDrive) []int {
+	var angles []int
+	for _, c := range sim.Commands() {
+		if c.Op == SimPulse && c.Port == int(bot.cfg.Yaw.Channel) {
+			for deg := 0; deg <= bot.cfg.MaxDegree; deg++ {
+				if bot.cfg.degree2pulse(deg) == c.Pulse {
+					angles = append(angles, deg)
+					break
+				}
+			}
+		}
+	}
+	return angles
+}
+
+func TestServoSmoothMotion(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Yaw.MaxVel, cfg.Yaw.MaxAccel = 600, 3000
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	bot.SetYaw(150)
+	if got := bot.YawAngle(); got != 90 {
+		t.Errorf("Expected: still at 90, Got: %d\n", got)
+	}
+	waitPod(t, bot, time.Second)
+	if got := bot.YawAngle(); got != 150 {
+		t.Fatalf("Expected: 150, Got: %d\n", got)
+	}
+	angles := yawAngles(bot, sim)
+	if len(angles) < 5 {
+		t.Fatalf("Expected: many intermediate angles, Got: %v\n", angles)
+	}
+	prev := 90
+	for _, deg := range angles {
+		if deg < prev {
+			t.Errorf("Expected: monotonic motion, Got: %v\n", angles)
+			break
+		}
+		prev = deg
+	}
+	// the first step is limited by the acceleration, not the velocity
+	if first := angles[0] - 90; first > 10 {
+		t.Errorf("Expected: a gentle first step, Got: %d deg\n", first)
+	}
+}
+
+func TestServoRetarget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Yaw.MaxVel, cfg.Yaw.MaxAccel = 600, 3000
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	bot.SetYaw(170)
+	time.Sleep(100 * time.Millisecond)
+	bot.SetYaw(30)
+	waitPod(t, bot, 2*time.Second)
+	if got := bot.YawAngle(); got != 30 {
+		t.Fatalf("Expected: 30, Got: %d\n", got)
+	}
+	// no jumps larger than a tick at max velocity, with slack for timer jitter
+	angles := yawAngles(bot, sim)
+	maxStep := 3 * cfg.Yaw.MaxVel * podTick.Seconds()
+	prev := 90
+	for _, deg := range angles {
+		if math.Abs(float64(deg-prev)) > maxStep {
+			t.Errorf("Expected: steps under %g deg, Got: %v\n", maxStep, angles)
+			break
+		}
+		prev = deg
+	}
+}
@@ -0,0 +1,140 @@
+package adabot
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// rampTick is the period at which the ramp goroutine slews the tracks and
+// regulates their speed.
+const rampTick = 20 * time.Millisecond
+
+// track is the state of one side of the tread chassis.
+type track struct {
+	cfg    TrackConfig
+	target float64 // signed power being ramped toward
+	power  float64 // signed power applied to the motor, open-loop
+
+	// Closed-loop, power is the fraction of TrackSpeed to regulate to
+	pid   pid
+	out   float64 // signed power applied to the motor, closed-loop
+	ticks int64   // encoder count at the last regulate
+}
+
+// clampPower limits a signed track power to the range -1 to 1.
+func clampPower(power float64) float64 {
+	if math.IsNaN(power) {
+		return 0
+	}
+	return math.Max(-1, math.Min(1, power))
+}
+
+// slew moves power toward target by at most step, stopping at zero rather
+// than reversing direction within a single step.
+func slew(power, target, step float64) float64 {
+	next := target
+	if math.Abs(target-power) > step {
+		next = power + math.Copysign(step, target-power)
+	}
+	if next*power < 0 {
+		// reversals pass through zero
+		next = 0
+	}
+	return next
+}
+
+// setTracks retargets both tracks.  Without a slew rate the motors change
+// speed at once, otherwise the ramp goroutine slews them.  Closed-loop, the
+// ramp goroutine regulates the speed in any case, and with a battery monitor
+// it watches the battery while the tracks run.  The caller must hold bot.mu.
+func (bot *Robot) setTracks(left, right float64) (err error) {
+	bot.left.target = clampPower(left)
+	bot.right.target = clampPower(right)
+	if bot.cfg.SlewRate <= 0 && bot.closedLoop() {
+		bot.left.power = bot.left.target
+		bot.right.power = bot.right.target
+	} else if bot.cfg.SlewRate <= 0 {
+		for _, tr := range []*track{&bot.left, &bot.right} {
+			if err = bot.runTrack(tr.cfg, tr.target); err != nil {
+				return
+			}
+			tr.power = tr.target
+		}
+		bot.odometer()
+		if bot.battery != nil && bot.running() {
+			bot.startRamp()
+		}
+		return
+	}
+	bot.startRamp()
+	return
+}
+
+// running reports whether either track is driven.  The caller must hold
+// bot.mu.
+func (bot *Robot) running() bool {
+	return bot.left.target != 0 || bot.right.target != 0
+}
+
+// startRamp starts the ramp goroutine unless it is running.  The caller
+// must hold bot.mu.
+func (bot *Robot) startRamp() {
+	if !bot.ramping {
+		bot.ramping = true
+		go bot.runRamp()
+	}
+}
+
+// runRamp slews both tracks every rampTick until they reach their targets.
+// Closed-loop, it carries on regulating their speed until both come to rest.
+// It also checks the progress of a Move or Rotate until it is done, and
+// the battery for as long as the tracks run.
+func (bot *Robot) runRamp() {
+	ticker := time.NewTicker(rampTick)
+	defer ticker.Stop()
+	last := time.Now()
+	for now := range ticker.C {
+		dt := now.Sub(last).Seconds()
+		last = now
+
+		bot.mu.Lock()
+		moving := false
+		if bot.battery != nil && bot.running() {
+			bot.checkBattery()
+			moving = bot.running()
+		}
+		for _, tr := range []*track{&bot.left, &bot.right} {
+			if tr.power == tr.target {
+				continue
+			}
+			next := slew(tr.power, tr.target, bot.cfg.SlewRate*dt)
+			if !bot.closedLoop() {
+				if err := bot.runTrack(tr.cfg, next); err != nil {
+					log.Printf("%s\n", err.Error())
+				}
+			}
+			tr.power = next
+			if next != tr.target {
+				moving = true
+			}
+		}
+		if bot.closedLoop() {
+			if bot.regulate(dt) {
+				moving = true
+			}
+		} else {
+			bot.odometer()
+		}
+		if bot.motion != nil {
+			bot.checkMotion(time.Now())
+			moving = true
+		}
+		if !moving {
+			bot.ramping = false
+			bot.mu.Unlock()
+			return
+		}
+		bot.mu.Unlock()
+	}
+}
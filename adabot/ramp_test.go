@@ -0,0 +1,133 @@
+package adabot
+
+import (
+	"testing"
+	"time"
+)
+
+// waitRamp waits for the ramp goroutine to bring both tracks to their targets.
+func waitRamp(t *testing.T, bot *Robot, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		bot.mu.Lock()
+		ramping := bot.ramping
+		bot.mu.Unlock()
+		if !ramping {
+			return
+		}
+		time.Sleep(rampTick)
+	}
+	t.Fatalf("Expected: tracks at target within %s\n", timeout)
+}
+
+// motorRuns returns the speed set before each run command of the motor, in
+// order, with a zero speed for every release.
+func motorRuns(sim *SimDrive, motor int) (speeds []int32, dirs []Direction) {
+	var speed int32
+	for _, c := range sim.Commands() {
+		if c.Port != motor {
+			continue
+		}
+		switch c.Op {
+		case SimSpeed:
+			speed = c.Speed
+		case SimRun:
+			if c.Dir == MotorRelease {
+				speed = 0
+			}
+			speeds = append(speeds, speed)
+			dirs = append(dirs, c.Dir)
+		}
+	}
+	return
+}
+
+func TestSlew(t *testing.T) {
+	cases := []struct {
+		power, target, step, want float64
+	}{
+		{0, 1, 0.25, 0.25},
+		{0.9, 1, 0.25, 1},
+		{1, 0, 0.25, 0.75},
+		{0.1, -1, 0.25, 0},
+		{0, -1, 0.25, -0.25},
+	}
+	for _, c := range cases {
+		if got := slew(c.power, c.target, c.step); got != c.want {
+			t.Errorf("slew(%g, %g, %g): Expected: %g, Got: %g\n",
+				c.power, c.target, c.step, c.want, got)
+		}
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SlewRate = 10
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	bot.Forward(0, 1)
+	if m := sim.Motor(3); m.Speed == 255 {
+		t.Errorf("Expected: ramping, Got: full speed at once\n")
+	}
+	waitRamp(t, bot, time.Second)
+	speeds, _ := motorRuns(sim, 3)
+	if len(speeds) < 3 || speeds[len(speeds)-1] != 255 {
+		t.Fatalf("Expected: several steps up to 255, Got: %v\n", speeds)
+	}
+	for i := 1; i < len(speeds); i++ {
+		if speeds[i] < speeds[i-1] {
+			t.Errorf("Expected: increasing speeds, Got: %v\n", speeds)
+			break
+		}
+	}
+}
+
+func TestRampReversalPassesZero(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SlewRate = 20
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	bot.Forward(0, 1)
+	waitRamp(t, bot, time.Second)
+	sim.Reset()
+	bot.Backward(0, 1)
+	waitRamp(t, bot, time.Second)
+
+	speeds, dirs := motorRuns(sim, 3)
+	released := -1
+	for i, d := range dirs {
+		if d == MotorRelease {
+			released = i
+			break
+		}
+	}
+	if released <= 0 || released == len(dirs)-1 {
+		t.Fatalf("Expected: backward, release, forward, Got: %v %v\n", dirs, speeds)
+	}
+	// the default chassis is wired flipped: forward runs the motor backward
+	if dirs[0] != MotorBackward || dirs[len(dirs)-1] != MotorForward {
+		t.Errorf("Expected: backward then forward, Got: %v\n", dirs)
+	}
+}
+
+func TestStopRampsDown(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SlewRate = 10
+	bot, sim := newSimRobotConfig(t, cfg)
+
+	bot.Forward(0, 1)
+	waitRamp(t, bot, time.Second)
+	sim.Reset()
+	bot.Stop()
+	waitRamp(t, bot, time.Second)
+	speeds, dirs := motorRuns(sim, 3)
+	if len(speeds) < 3 || dirs[len(dirs)-1] != MotorRelease {
+		t.Fatalf("Expected: several steps down to release, Got: %v %v\n", speeds, dirs)
+	}
+	for i := 1; i < len(speeds); i++ {
+		if speeds[i] > speeds[i-1] {
+			t.Errorf("Expected: decreasing speeds, Got: %v\n", speeds)
+			break
+		}
+	}
+}
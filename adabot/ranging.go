@@ -0,0 +1,102 @@
+package adabot
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// rangeTick is the period at which the guard goroutine reads the range
+// sensor while driving forward.
+const rangeTick = 50 * time.Millisecond
+
+// ErrObstacle is returned by forward motion blocked by an obstacle closer
+// than the configured stop distance.
+var ErrObstacle = errors.New("obstacle ahead")
+
+// Ranger is implemented by a Drive that measures the distance to the
+// nearest obstacle ahead of the robot.
+type Ranger interface {
+	// Range returns the distance (in m), +Inf when nothing is in range.
+	Range() (float64, error)
+}
+
+// Range returns the distance to the nearest obstacle ahead of the robot (in
+// m), +Inf when nothing is in range.
+func (bot *Robot) Range() (float64, error) {
+	if bot.ranger == nil {
+		return 0, errors.New("no range sensor fitted")
+	}
+	return bot.ranger.Range()
+}
+
+// forward reports whether the tracks are driving the robot forward, rather
+// than backward or spinning on the spot.  The caller must hold bot.mu.
+func (bot *Robot) forward() bool {
+	return bot.left.target+bot.right.target > 0
+}
+
+// clearAhead fails with ErrObstacle when driving the tracks at the given
+// powers would head into an obstacle.  The caller must hold bot.mu.
+func (bot *Robot) clearAhead(left, right float64) error {
+	if bot.ranger == nil || left+right <= 0 {
+		return nil
+	}
+	dist, err := bot.ranger.Range()
+	if err != nil {
+		return err
+	}
+	if dist < bot.cfg.Range.Stop {
+		return ErrObstacle
+	}
+	return nil
+}
+
+// startGuard starts the guard goroutine unless it is running or the robot
+// is not driving forward.  The caller must hold bot.mu.
+func (bot *Robot) startGuard() {
+	if bot.ranger == nil || bot.guarding || !bot.forward() {
+		return
+	}
+	bot.guarding = true
+	go bot.runGuard()
+}
+
+// runGuard reads the range sensor every rangeTick for as long as the robot
+// drives forward, and halts it short of an obstacle.  A sensor that fails
+// halts it too.
+func (bot *Robot) runGuard() {
+	ticker := time.NewTicker(rangeTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		// the sensor may take a while, don't hold up the other commands
+		dist, err := bot.ranger.Range()
+
+		bot.mu.Lock()
+		if !bot.forward() {
+			bot.guarding = false
+			bot.mu.Unlock()
+			return
+		}
+		if err == nil && dist >= bot.cfg.Range.Stop {
+			bot.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			log.Printf("range: %s, stopping\n", err.Error())
+		} else {
+			log.Printf("range: obstacle at %.2fm, stopping\n", dist)
+		}
+		if bot.motion != nil {
+			bot.motion.finish(ErrObstacle)
+			bot.motion = nil
+		}
+		bot.cancel()
+		if err = bot.halt(); err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+		bot.guarding = false
+		bot.mu.Unlock()
+		return
+	}
+}
@@ -0,0 +1,114 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	net "github.com/jfinken/gobot-lab/adabot/network"
+)
+
+func newRangeRobot(t *testing.T, stop float64) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.Range = RangeConfig{Sensor: "lidarlite", Stop: stop}
+	return newSimRobotConfig(t, cfg)
+}
+
+func TestSimRange(t *testing.T) {
+	sim := NewSimDrive()
+
+	if d, _ := sim.Range(); !math.IsInf(d, 1) {
+		t.Errorf("Expected: +Inf, Got: %g\n", d)
+	}
+	sim.AddWall(1, -1, 1, 1)
+	sim.AddWall(0.5, 0.2, 0.5, 1)
+	if d, _ := sim.Range(); math.Abs(d-1) > 1e-9 {
+		t.Errorf("Expected: 1, Got: %g\n", d)
+	}
+	sim.AddWall(10, -1, 10, 1)
+	sim.AddWall(-2, -1, -2, 1)
+	if d, _ := sim.Range(); math.Abs(d-1) > 1e-9 {
+		t.Errorf("Expected: 1, Got: %g\n", d)
+	}
+}
+
+func TestSimRangeFloorplan(t *testing.T) {
+	sim := NewSimDrive()
+	sim.AddFloorplan(&net.Floorplan{Polygons: []net.Polygon{
+		// a 3m x 2m room around the origin
+		{Area: 6, Layer: net.Wall, IsClosed: true, Verts: [][]float64{{-1, -1}, {2, -1}, {2, 1}, {-1, 1}}},
+		// the floor is not an obstacle
+		{Area: 0.1, Layer: net.Space, IsClosed: true, Verts: [][]float64{{0.5, -1}, {0.5, 1}, {0.6, 0}}},
+		// nor is clutter, too small to be a wall
+		{Area: 0.01, Layer: net.Wall, IsClosed: true, Verts: [][]float64{{1, -0.05}, {1.1, -0.05}, {1.1, 0.05}, {1, 0.05}}},
+	}})
+	if d, _ := sim.Range(); math.Abs(d-2) > 1e-9 {
+		t.Errorf("Expected: 2, Got: %g\n", d)
+	}
+
+	// the same room in cm
+	sim = NewSimDrive()
+	sim.AddFloorplan(&net.Floorplan{Scale: 0.01, Polygons: []net.Polygon{
+		{Area: 60000, Layer: net.Wall, IsClosed: true, Verts: [][]float64{{-100, -100}, {200, -100}, {200, 100}, {-100, 100}}},
+		{Area: 100, Layer: net.Wall, IsClosed: true, Verts: [][]float64{{100, -5}, {110, -5}, {110, 5}, {100, 5}}},
+	}})
+	if d, _ := sim.Range(); math.Abs(d-2) > 1e-9 {
+		t.Errorf("Expected: 2, Got: %g\n", d)
+	}
+}
+
+func TestObstacleBlocksForward(t *testing.T) {
+	bot, sim := newRangeRobot(t, 0.2)
+	sim.AddWall(0.1, -1, 0.1, 1)
+
+	if err := bot.Forward(1, 1); err != ErrObstacle {
+		t.Errorf("Expected: %v, Got: %v\n", ErrObstacle, err)
+	}
+	if _, err := bot.StartMove(0.5, 1); err != ErrObstacle {
+		t.Errorf("Expected: %v, Got: %v\n", ErrObstacle, err)
+	}
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+	// backing off and turning away are fine
+	if err := bot.Backward(0, 1); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+	if err := bot.Left(0, 1); err != nil {
+		t.Errorf("Expected: nil, Got: %v\n", err)
+	}
+}
+
+func TestObstacleStopsForward(t *testing.T) {
+	bot, sim := newRangeRobot(t, 0.15)
+	sim.AddWall(0.3, -1, 0.3, 1)
+
+	if err := bot.Forward(0, 0.5); err != nil {
+		t.Fatalf(err.Error())
+	}
+	time.Sleep(time.Second)
+	for _, port := range []int{2, 3} {
+		if m := sim.Motor(port); m.Dir != MotorRelease {
+			t.Errorf("Expected: motor %d released, Got: %s\n", port, m.Dir)
+		}
+	}
+	// within a rangeTick of the stop distance
+	if p := sim.Pose(); p.X < 0.14 || p.X > 0.16 {
+		t.Errorf("Expected: stopped about 0.15m from the wall, Got: %+v\n", p)
+	}
+	if err := bot.Forward(0, 0.5); err != ErrObstacle {
+		t.Errorf("Expected: %v, Got: %v\n", ErrObstacle, err)
+	}
+}
+
+func TestObstacleStopsMove(t *testing.T) {
+	bot, sim := newRangeRobot(t, 0.15)
+	sim.AddWall(0.3, -1, 0.3, 1)
+
+	if err := bot.Move(1, 0.5); err != ErrObstacle {
+		t.Errorf("Expected: %v, Got: %v\n", ErrObstacle, err)
+	}
+	if p := sim.Pose(); p.X > 0.16 {
+		t.Errorf("Expected: stopped short of the wall, Got: %+v\n", p)
+	}
+}
@@ -1,244 +1,315 @@
 package adabot
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"sync"
 	"time"
-
-	"gobot.io/x/gobot/drivers/i2c"
-	"gobot.io/x/gobot/platforms/raspi"
 )
 
-var (
-	// Min pulse length out of 4096
-	servoMin = 150
-	// Max pulse length out of 4096
-	servoMax = 700
-	// Limiting the max this servo can rotate (in deg)
-	maxDegree = 180
-	// Number of degrees to increase per call
-	degIncrease       = 10
-	yawDeg            = 90
-	pitchDeg          = 90
-	yawChannel   byte = 1
-	pitchChannel byte = 2
-)
+// maxSpeed is the full speed accepted by SetDCMotorSpeed.
+const maxSpeed = 255
 
-func degree2pulse(deg int) int32 {
-	pulse := servoMin
-	pulse += ((servoMax - servoMin) / maxDegree) * deg
-	return int32(pulse)
+// clamp01 limits a throttle to the range 0 to 1.
+func clamp01(throttle float64) float64 {
+	return math.Max(0, math.Min(1, throttle))
 }
 
-// Robot defines a type abstracting the unexported driver type.
-type Robot struct {
-	adafruit *i2c.AdafruitMotorHatDriver
+// throttle2speed maps a throttle fraction, clamped to [0, 1], onto the
+// 0-255 speed range accepted by SetDCMotorSpeed.
+func throttle2speed(throttle float64) int32 {
+	if math.IsNaN(throttle) {
+		return 0
+	}
+	return int32(math.Round(clamp01(throttle) * maxSpeed))
+}
+
+// seconds converts fractional seconds to a time.Duration.
+func seconds(sec float64) time.Duration {
+	return time.Duration(sec * float64(time.Second))
 }
 
-// NewRobot constructs and initializes an unexported driver object.
-func NewRobot() (*Robot, error) {
+// Robot defines a type abstracting the motor and servo backend.
+type Robot struct {
+	drive    Drive
+	encoders Encoders // nil when the tracks run open-loop
+	ranger   Ranger   // nil without a range sensor
+	imu      IMU      // nil without an IMU
+	battery  Battery  // nil without a battery monitor
+	stepper  Stepper  // nil without a stepper motor
+	cfg      Config
 
-	// Now in gobot.io 1.0: Metal Gobot
-	// 	when you want to use the individual Gobot packages yourself to have the
-	//  greatest control, or to more easily integrate Gobot functionality into
-	//  your existing Golang programs.
-	r := raspi.NewAdaptor()
-	r.Connect()
-	adaFruit := i2c.NewAdafruitMotorHatDriver(r)
-	adaFruit.Start()
+	estop int32 // latched by EStop, read and written atomically
 
-	/*
-		// Custom init for attached servo hat and motors
-		// Changing from the default 0x40 address because this configuration involves
-		// a Servo HAT stacked on top of a DC/Stepper Motor HAT on top of the Pi.
-		stackedHatAddr := 0x41
+	mu       sync.Mutex
+	timer    *time.Timer   // releases the motors at the end of a timed move
+	timed    chan struct{} // closed once the timed move is over, see WaitMove
+	motion   *Motion       // Move or Rotate in progress
+	gen      int           // bumped by every tread command to retire stale timers
+	ramping  bool          // the ramp goroutine is slewing the tracks
+	guarding bool          // the guard goroutine is watching the range ahead
+	dog      *time.Timer   // deadman watchdog, stops the treads unless fed
+	dogGen   int           // bumped by every feed to retire stale watchdogs
+	left     track
+	right    track
+	odom     odometry // dead reckoned from the track power
+	fused    fusion   // heading from the IMU and the odometry
 
-		// update the I2C address state
-		adaFruit.SetServoHatAddress(stackedHatAddr)
+	stepMotor *stepperMotor        // nil without a stepper motor
+	actuators map[string]*actuator // by name, built in or declared
+	servos    []*servo             // of the camera pod then declared
 
-		freq := 60.0
-		if err := adaFruit.SetServoMotorFreq(freq); err != nil {
-			return nil, err
+	podMu     sync.Mutex
+	podMoving bool // the pod goroutine is stepping the servos
+	yaw       servo
+	pitch     servo
+}
+
+// NewRobot constructs a Robot on top of the given backend, e.g. NewHatDrive
+// on the Pi or NewSimDrive anywhere else.  A nil cfg uses DefaultConfig,
+// otherwise cfg is validated first, see LoadConfig.
+func NewRobot(drive Drive, cfg *Config) (*Robot, error) {
+	if drive == nil {
+		return nil, fmt.Errorf("NewRobot: nil Drive")
+	}
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	bot := &Robot{drive: drive, cfg: *cfg}
+	bot.left = track{cfg: cfg.Left}
+	bot.right = track{cfg: cfg.Right}
+	bot.odom = newOdometry(cfg.Wheelbase, time.Now())
+	if sim, ok := drive.(*SimDrive); ok {
+		// the simulator keeps the true pose of the chassis it drives
+		sim.SetChassis(cfg)
+	}
+	if ranger, ok := drive.(Ranger); ok && cfg.Range.Sensor != "" {
+		bot.ranger = ranger
+	}
+	if battery, ok := drive.(Battery); ok && cfg.Battery.Monitor != "" {
+		bot.battery = battery
+	}
+	if stepper, ok := drive.(Stepper); ok {
+		bot.stepper = stepper
+		if cfg.Stepper.StepsPerRev > 0 {
+			bot.stepMotor = &stepperMotor{cfg: cfg.Stepper}
 		}
-		// start in the middle of the 180-deg range in both yaw and pitch
-		pulse := degree2pulse(yawDeg)
-		if err := adaFruit.SetServoMotorPulse(yawChannel, 0, pulse); err != nil {
-			return nil, err
+	}
+	if imu, ok := drive.(IMU); ok && cfg.IMU.Sensor != "" {
+		bot.imu = imu
+		bot.resetHeading()
+	}
+	if enc, ok := drive.(Encoders); ok && cfg.Left.TicksPerMeter > 0 {
+		bot.encoders = enc
+		for _, tr := range []*track{&bot.left, &bot.right} {
+			tr.pid.cfg = cfg.SpeedPID
+			ticks, err := enc.Ticks(tr.cfg.Motor)
+			if err != nil {
+				return nil, err
+			}
+			tr.ticks = ticks
 		}
-		pulse = degree2pulse(pitchDeg)
-		if err := adaFruit.SetServoMotorPulse(pitchChannel, 0, pulse); err != nil {
+	}
+	// start in the middle of the soft limits in both yaw and pitch
+	bot.yaw = newServo(cfg.Yaw)
+	bot.pitch = newServo(cfg.Pitch)
+	bot.servos = []*servo{&bot.yaw, &bot.pitch}
+	if err := bot.addActuators(cfg); err != nil {
+		return nil, err
+	}
+
+	// Custom init for an attached servo hat
+	if cfg.ServoHatAddr != 0 {
+		if err := drive.SetServoMotorFreq(cfg.ServoFreq); err != nil {
 			return nil, err
 		}
-	*/
-	return &Robot{adafruit: adaFruit}, nil
+		for _, s := range bot.servos {
+			if err := bot.writeServo(s, s.deg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bot, nil
 }
 
-// Stop releases both DC-Motors.  Stop that shizzle
+// Stop ramps down and releases both DC-Motors and cancels any pending timed
+// move.  Stop that shizzle
 func (bot *Robot) Stop() (err error) {
-	// NOTE: these equate to the HAT "port", see Google docs wiring diagram
-	motorPort := 3
-	motorStarboard := 2
-	if err = bot.adafruit.RunDCMotor(motorPort, i2c.AdafruitRelease); err != nil {
-		return
-	}
-	if err = bot.adafruit.RunDCMotor(motorStarboard, i2c.AdafruitRelease); err != nil {
-		return
-	}
-	return
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.cancel()
+	return bot.release()
 }
 
-// Left runs both DC-Motors in opposite directions
-func (bot *Robot) Left(sec int) (err error) {
-	// NOTE: these equate to the HAT "port", see Google docs wiring diagram
-	motorPort := 3
-	motorStarboard := 2
-	var speed int32 = 255 // 255 = full speed!
-	if err = bot.adafruit.SetDCMotorSpeed(motorPort, speed); err != nil {
-		return
-	}
-	if err = bot.adafruit.SetDCMotorSpeed(motorStarboard, speed); err != nil {
-		return
-	}
-	//------------------------------------
-	// BUG: direction or wiring is flipped
-	//------------------------------------
-	if err = bot.adafruit.RunDCMotor(motorPort, i2c.AdafruitForward); err != nil {
-		return
+// cancel stops the release timer of a pending timed move, if any, and
+// cancels a Move or Rotate in progress.  The caller must hold bot.mu.
+func (bot *Robot) cancel() {
+	if bot.timer != nil {
+		bot.timer.Stop()
+		bot.timer = nil
+		close(bot.timed)
+		bot.timed = nil
 	}
-	if err = bot.adafruit.RunDCMotor(motorStarboard, i2c.AdafruitBackward); err != nil {
-		return
+	if bot.motion != nil {
+		bot.motion.finish(ErrCancelled)
+		bot.motion = nil
 	}
-	return
+	bot.gen++
 }
 
-// Right runs both DC-Motors in opposite directions
-func (bot *Robot) Right(sec int) (err error) {
-	// NOTE: these equate to the HAT "port", see Google docs wiring diagram
-	motorPort := 3
-	motorStarboard := 2
-	var speed int32 = 255 // 255 = full speed!
-	if err = bot.adafruit.SetDCMotorSpeed(motorPort, speed); err != nil {
+// releaseAfter stops the motors once sec seconds have elapsed, unless a
+// newer command arrives first.  A non-positive sec runs until the next
+// command.  The caller must hold bot.mu.
+func (bot *Robot) releaseAfter(sec float64) {
+	if sec <= 0 {
 		return
 	}
-	if err = bot.adafruit.SetDCMotorSpeed(motorStarboard, speed); err != nil {
-		return
-	}
-	// BUG: direction
-	if err = bot.adafruit.RunDCMotor(motorPort, i2c.AdafruitBackward); err != nil {
-		return
+	gen, done := bot.gen, make(chan struct{})
+	bot.timed = done
+	bot.timer = time.AfterFunc(seconds(sec), func() {
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		if bot.gen != gen {
+			return
+		}
+		bot.timer = nil
+		close(done)
+		bot.timed = nil
+		if err := bot.release(); err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+	})
+}
+
+// WaitMove blocks until the timed move in progress, if any, has run its
+// time or was cut short by a newer command.
+func (bot *Robot) WaitMove() {
+	bot.mu.Lock()
+	done := bot.timed
+	bot.mu.Unlock()
+	if done != nil {
+		<-done
 	}
-	if err = bot.adafruit.RunDCMotor(motorStarboard, i2c.AdafruitForward); err != nil {
-		return
+}
+
+// release ramps down and releases both DC-Motors.  The caller must hold
+// bot.mu.
+func (bot *Robot) release() error {
+	return bot.setTracks(0, 0)
+}
+
+// halt immediately releases both DC-Motors, without ramping down.  The
+// caller must hold bot.mu.
+func (bot *Robot) halt() (err error) {
+	for _, tr := range []*track{&bot.left, &bot.right} {
+		tr.target, tr.power, tr.out = 0, 0, 0
+		tr.pid.reset()
+		if e := bot.drive.RunDCMotor(tr.cfg.Motor, MotorRelease); e != nil && err == nil {
+			err = e
+		}
 	}
+	bot.odometer()
 	return
 }
 
-// Backward runs both DC-Motors backward
-func (bot *Robot) Backward(sec int) (err error) {
-	// NOTE: these equate to the HAT "port", see Google docs wiring diagram
-	motorPort := 3
-	motorStarboard := 2
-	var speed int32 = 255 // 255 = full speed!
-	if err = bot.adafruit.SetDCMotorSpeed(motorPort, speed); err != nil {
-		return
+// runTrack runs the DC-Motor of one track at the signed power, -1 to 1,
+// where positive drives the track forward.  Zero power releases the motor.
+// The caller must hold bot.mu.
+func (bot *Robot) runTrack(track TrackConfig, power float64) (err error) {
+	if track.Invert {
+		power = -power
 	}
-	if err = bot.adafruit.SetDCMotorSpeed(motorStarboard, speed); err != nil {
-		return
+	dir := MotorForward
+	if power < 0 {
+		dir = MotorBackward
+		power = -power
 	}
-	// run
-	if err = bot.adafruit.RunDCMotor(motorPort, i2c.AdafruitForward); err != nil {
-		return
+	speed := throttle2speed(power)
+	if speed == 0 {
+		return bot.drive.RunDCMotor(track.Motor, MotorRelease)
 	}
-	if err = bot.adafruit.RunDCMotor(motorStarboard, i2c.AdafruitForward); err != nil {
+	if err = bot.drive.SetDCMotorSpeed(track.Motor, speed); err != nil {
 		return
 	}
-	return
+	return bot.drive.RunDCMotor(track.Motor, dir)
 }
 
-// Forward runs both DC-Motors forward.
-func (bot *Robot) Forward(sec int) (err error) {
-	// NOTE: these equate to the HAT "port", see Google docs wiring diagram
-	motorPort := 3
-	motorStarboard := 2
-	var speed int32 = 255 // 255 = full speed!
-	if err = bot.adafruit.SetDCMotorSpeed(motorPort, speed); err != nil {
-		return
+// Drive runs the left and right tracks at the given signed power, -1 to 1,
+// until the next command.  Unequal powers drive an arc.  The tracks ramp to
+// the new power at the configured slew rate.
+func (bot *Robot) Drive(left, right float64) error {
+	return bot.DriveFor(left, right, 0)
+}
+
+// DriveFor runs the left and right tracks at the given signed power, -1 to
+// 1, for sec seconds, or until the next command when sec is not positive.
+// It fails with ErrEStop while the e-stop is latched, with ErrObstacle when
+// heading forward into an obstacle and with ErrBatteryLow on a flat
+// battery.  A low battery limits the power.
+func (bot *Robot) DriveFor(left, right, sec float64) (err error) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	if bot.EStopped() {
+		return ErrEStop
 	}
-	if err = bot.adafruit.SetDCMotorSpeed(motorStarboard, speed); err != nil {
+	if left, right, err = bot.limitPower(left, right); err != nil {
 		return
 	}
-	// run
-	if err = bot.adafruit.RunDCMotor(motorPort, i2c.AdafruitBackward); err != nil {
+	if err = bot.clearAhead(left, right); err != nil {
 		return
 	}
-	if err = bot.adafruit.RunDCMotor(motorStarboard, i2c.AdafruitBackward); err != nil {
+	bot.cancel()
+	bot.feed()
+
+	if err = bot.setTracks(left, right); err != nil {
 		return
 	}
+	bot.releaseAfter(sec)
+	bot.startGuard()
 	return
 }
 
-// Pitch will rotate the vertical oriented servo up/down based on the sign of dir.
-func (bot *Robot) Pitch(dir int) (err error) {
-	var pulse int32
-	if dir > 0 {
-		pitchDeg -= degIncrease
-		pulse = degree2pulse(pitchDeg)
-	} else {
-		pitchDeg += degIncrease
-		pulse = degree2pulse(pitchDeg)
-	}
-	if err = bot.adafruit.SetServoMotorPulse(pitchChannel, 0, pulse); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-	return
+// DriveAt runs the left and right tracks at the given signed speeds (in
+// m/s) for sec seconds, or until the next command when sec is not positive.
+// The speeds are only held on tracks fitted with encoders, open-loop they
+// rely on the TrackSpeed calibration.
+func (bot *Robot) DriveAt(left, right, sec float64) error {
+	return bot.DriveFor(left/bot.cfg.TrackSpeed, right/bot.cfg.TrackSpeed, sec)
 }
 
-// Yaw will rotate the horizontal oriented servo left/right based on the sign of dir.
-func (bot *Robot) Yaw(dir int) (err error) {
+// Left spins the tracks in opposite directions for sec seconds, or until
+// the next command when sec is not positive.  Throttle is the fraction of
+// full speed, 0 to 1.
+func (bot *Robot) Left(sec, throttle float64) error {
+	throttle = clamp01(throttle)
+	return bot.DriveFor(-throttle, throttle, sec)
+}
 
-	var pulse int32
-	if dir <= 0 {
-		// DEC
-		yawDeg -= degIncrease
-		pulse = degree2pulse(yawDeg)
-	} else {
-		// INCR
-		yawDeg += degIncrease
-		pulse = degree2pulse(yawDeg)
-	}
-	if err = bot.adafruit.SetServoMotorPulse(yawChannel, 0, pulse); err != nil {
-		log.Printf(err.Error())
-		return
-	}
-	return
+// Right spins the tracks in opposite directions for sec seconds, or until
+// the next command when sec is not positive.  Throttle is the fraction of
+// full speed, 0 to 1.
+func (bot *Robot) Right(sec, throttle float64) error {
+	throttle = clamp01(throttle)
+	return bot.DriveFor(throttle, -throttle, sec)
 }
 
-// DCMotorRunner is simply a test runner for the given motor
-func (bot *Robot) DCMotorRunner(dcMotor int) (err error) {
+// Backward runs both tracks backward for sec seconds, or until the next
+// command when sec is not positive.  Throttle is the fraction of full
+// speed, 0 to 1.
+func (bot *Robot) Backward(sec, throttle float64) error {
+	throttle = clamp01(throttle)
+	return bot.DriveFor(-throttle, -throttle, sec)
+}
 
-	//log.Printf("%s\tRun Loop...\n", time.Now().String())
-	// set the speed:
-	var speed int32 = 255 // 255 = full speed!
-	if err = bot.adafruit.SetDCMotorSpeed(dcMotor, speed); err != nil {
-		return
-	}
-	// run FORWARD
-	if err = bot.adafruit.RunDCMotor(dcMotor, i2c.AdafruitForward); err != nil {
-		return
-	}
-	// Sleep and RELEASE
-	<-time.After(2000 * time.Millisecond)
-	if err = bot.adafruit.RunDCMotor(dcMotor, i2c.AdafruitRelease); err != nil {
-		return
-	}
-	// run BACKWARD
-	if err = bot.adafruit.RunDCMotor(dcMotor, i2c.AdafruitBackward); err != nil {
-		return
-	}
-	// Sleep and RELEASE
-	<-time.After(2000 * time.Millisecond)
-	if err = bot.adafruit.RunDCMotor(dcMotor, i2c.AdafruitRelease); err != nil {
-		return
-	}
-	return
+// Forward runs both tracks forward for sec seconds, or until the next
+// command when sec is not positive.  Throttle is the fraction of full
+// speed, 0 to 1.
+func (bot *Robot) Forward(sec, throttle float64) error {
+	throttle = clamp01(throttle)
+	return bot.DriveFor(throttle, throttle, sec)
 }
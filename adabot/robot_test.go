@@ -0,0 +1,190 @@
+package adabot
+
+import (
+	"testing"
+	"time"
+)
+
+func newSimRobot(t *testing.T) (*Robot, *SimDrive) {
+	return newSimRobotConfig(t, instant(DefaultConfig()))
+}
+
+func newSimRobotConfig(t *testing.T, cfg *Config) (*Robot, *SimDrive) {
+	sim := NewSimDrive()
+	bot, err := NewRobot(sim, cfg)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bot, sim
+}
+
+// instant turns off tread ramping and smooth servo motion so that speeds
+// and angles can be asserted as soon as they are set.
+func instant(cfg *Config) *Config {
+	cfg.SlewRate = 0
+	cfg.Yaw.MaxVel = 0
+	cfg.Pitch.MaxVel = 0
+	return cfg
+}
+
+func TestNewRobotNilDrive(t *testing.T) {
+	if _, err := NewRobot(nil, nil); err == nil {
+		t.Errorf("Expected: error, Got: nil")
+	}
+}
+
+func TestSimRecordsForward(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	if err := bot.Forward(1, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	cmds := sim.Commands()
+	if len(cmds) != 4 {
+		t.Fatalf("Expected: 4 commands, Got: %d\n", len(cmds))
+	}
+	for i := 1; i < len(cmds); i++ {
+		if cmds[i].At.Before(cmds[i-1].At) {
+			t.Errorf("Expected: increasing timestamps, Got: %v before %v\n",
+				cmds[i].At, cmds[i-1].At)
+		}
+	}
+	for _, port := range []int{2, 3} {
+		m := sim.Motor(port)
+		if m.Speed != 255 || m.Dir != MotorBackward {
+			t.Errorf("Expected: motor %d at 255 backward, Got: %d %s\n", port, m.Speed, m.Dir)
+		}
+	}
+}
+
+func TestSimRecordsStop(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	bot.Left(1, 1)
+	sim.Reset()
+	if err := bot.Stop(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	cmds := sim.Commands()
+	if len(cmds) != 2 {
+		t.Fatalf("Expected: 2 commands, Got: %d\n", len(cmds))
+	}
+	for _, c := range cmds {
+		if c.Op != SimRun || c.Dir != MotorRelease {
+			t.Errorf("Expected: run release, Got: %s %s\n", c.Op, c.Dir)
+		}
+	}
+}
+
+func TestSimRecordsServo(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	if err := bot.Yaw(1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	cmds := sim.Commands()
+	if len(cmds) != 1 || cmds[0].Op != SimPulse || cmds[0].Port != int(bot.cfg.Yaw.Channel) {
+		t.Fatalf("Expected: one yaw pulse, Got: %+v\n", cmds)
+	}
+	if sim.Pulse(bot.cfg.Yaw.Channel) != cmds[0].Pulse {
+		t.Errorf("Expected: %d, Got: %d\n", cmds[0].Pulse, sim.Pulse(bot.cfg.Yaw.Channel))
+	}
+}
+
+func TestTimedMoveReleases(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	if err := bot.Forward(0.05, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Fatalf("Expected: running, Got: %s\n", m.Dir)
+	}
+	time.Sleep(150 * time.Millisecond)
+	for _, port := range []int{2, 3} {
+		if m := sim.Motor(port); m.Dir != MotorRelease {
+			t.Errorf("Expected: motor %d released, Got: %s\n", port, m.Dir)
+		}
+	}
+}
+
+func TestTimedMoveCancelledByNewerCommand(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	bot.Forward(0.05, 1)
+	// run until the next command, the pending release must not fire
+	bot.Left(0, 1)
+	time.Sleep(150 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir != MotorForward {
+		t.Errorf("Expected: forward, Got: %s\n", m.Dir)
+	}
+	if m := sim.Motor(2); m.Dir != MotorBackward {
+		t.Errorf("Expected: backward, Got: %s\n", m.Dir)
+	}
+}
+
+func TestStopCancelsTimedMove(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	bot.Forward(0.05, 1)
+	bot.Stop()
+	sim.Reset()
+	time.Sleep(150 * time.Millisecond)
+	if cmds := sim.Commands(); len(cmds) != 0 {
+		t.Errorf("Expected: no commands after Stop, Got: %+v\n", cmds)
+	}
+}
+
+func TestThrottle2Speed(t *testing.T) {
+	cases := []struct {
+		throttle float64
+		speed    int32
+	}{
+		{0, 0},
+		{0.5, 128},
+		{1, 255},
+		{-0.3, 0},
+		{2, 255},
+	}
+	for _, c := range cases {
+		if got := throttle2speed(c.throttle); got != c.speed {
+			t.Errorf("throttle %g: Expected: %d, Got: %d\n", c.throttle, c.speed, got)
+		}
+	}
+}
+
+func TestDriveArc(t *testing.T) {
+	bot, sim := newSimRobot(t)
+
+	if err := bot.Drive(0.4, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// both tracks are wired flipped on the default chassis
+	if m := sim.Motor(3); m.Speed != 102 || m.Dir != MotorBackward {
+		t.Errorf("Expected: left 102 backward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	if m := sim.Motor(2); m.Speed != 255 || m.Dir != MotorBackward {
+		t.Errorf("Expected: right 255 backward, Got: %d %s\n", m.Speed, m.Dir)
+	}
+	bot.Drive(-1, 0)
+	if m := sim.Motor(3); m.Dir != MotorForward {
+		t.Errorf("Expected: left forward, Got: %s\n", m.Dir)
+	}
+	if m := sim.Motor(2); m.Dir != MotorRelease {
+		t.Errorf("Expected: right released, Got: %s\n", m.Dir)
+	}
+}
+
+func TestDriveConfiguredTracks(t *testing.T) {
+	cfg := instant(DefaultConfig())
+	cfg.Left = TrackConfig{Motor: 1}
+	cfg.Right = TrackConfig{Motor: 0, Invert: true}
+	bot, sim := newSimRobotConfig(t, cfg)
+	bot.Forward(0, 1)
+	if m := sim.Motor(1); m.Dir != MotorForward {
+		t.Errorf("Expected: motor 1 forward, Got: %s\n", m.Dir)
+	}
+	if m := sim.Motor(0); m.Dir != MotorBackward {
+		t.Errorf("Expected: motor 0 backward, Got: %s\n", m.Dir)
+	}
+}
@@ -0,0 +1,248 @@
+package adabot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// selfTestPower and selfTestRun are how hard and how long the self-test
+	// runs each DC motor either way.
+	selfTestPower = 0.4
+	selfTestRun   = 500 * time.Millisecond
+	// selfTestSteps is how far the self-test turns each stepper either way.
+	selfTestSteps = 10
+	// servoSettle bounds the wait for a servo to reach an angle.
+	servoSettle = 3 * time.Second
+)
+
+// I2C addresses of the sensors, as shipped.
+const (
+	lidarLiteAddr = 0x62
+	mpu6050Addr   = 0x68
+	ads1015Addr   = 0x48
+)
+
+// Prober is implemented by a Drive that checks whether an I2C device
+// answers at an address.
+type Prober interface {
+	Probe(addr int) error
+}
+
+// SelfTestResult is the outcome of one check of the self-test.
+type SelfTestResult struct {
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail"`
+}
+
+// SelfTestReport is the outcome of the self-test, which passes when every
+// check does.
+type SelfTestReport struct {
+	Pass    bool             `json:"pass"`
+	Results []SelfTestResult `json:"results"`
+}
+
+// check records the outcome of a check: it fails with err, otherwise it
+// passes with the formatted detail.
+func (r *SelfTestReport) check(name string, err error, format string, args ...interface{}) {
+	res := SelfTestResult{Name: name, Pass: err == nil}
+	if err != nil {
+		res.Detail = err.Error()
+		r.Pass = false
+	} else {
+		res.Detail = fmt.Sprintf(format, args...)
+	}
+	r.Results = append(r.Results, res)
+}
+
+// String formats the report one check per line, then the verdict.
+func (r SelfTestReport) String() string {
+	var b strings.Builder
+	verdict := map[bool]string{true: "PASS", false: "FAIL"}
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "%s  %-20s %s\n", verdict[res.Pass], res.Name, res.Detail)
+	}
+	fmt.Fprintf(&b, "self-test: %s\n", verdict[r.Pass])
+	return b.String()
+}
+
+// SelfTest checks that every HAT and sensor answers on the I2C bus, reads
+// every sensor, then exercises every actuator in turn: each DC motor and
+// track runs forward then backward, checked by its encoder if fitted, each
+// servo sweeps to its limits and back, and each stepper turns forward and
+// back.  The robot moves, so give it room or put it on a stand.  It stops
+// at the e-stop.
+func (bot *Robot) SelfTest() SelfTestReport {
+	r := SelfTestReport{Pass: true}
+	bot.testI2C(&r)
+	bot.testSensors(&r)
+	for _, a := range bot.Actuators() {
+		if bot.EStopped() {
+			r.check("e-stop", ErrEStop, "")
+			break
+		}
+		name := a.Type + " " + a.Name
+		switch a.Type {
+		case ActuatorDC:
+			r.check(name, bot.testMotor(a.Name), "ran forward and backward")
+		case ActuatorServo:
+			r.check(name, bot.testServo(a), "swept %g-%g deg", a.Min, a.Max)
+		case ActuatorStepper:
+			r.check(name, bot.testStepper(a), "stepped forward and back")
+		}
+	}
+	return r
+}
+
+// testI2C probes the address of every device on the I2C bus.
+func (bot *Robot) testI2C(r *SelfTestReport) {
+	prober, ok := bot.drive.(Prober)
+	if !ok {
+		r.check("i2c", nil, "not probed by this drive")
+		return
+	}
+	type device struct {
+		name string
+		addr int
+	}
+	devices := []device{{"motor hat", bot.cfg.MotorHatAddr}}
+	if bot.cfg.ServoHatAddr != 0 {
+		devices = append(devices, device{"servo hat", bot.cfg.ServoHatAddr})
+	}
+	if bot.cfg.Range.Sensor == "lidarlite" {
+		devices = append(devices, device{"lidarlite", lidarLiteAddr})
+	}
+	if bot.cfg.IMU.Sensor == "mpu6050" {
+		devices = append(devices, device{"mpu6050", mpu6050Addr})
+	}
+	if bot.cfg.Battery.Monitor == "ads1015" {
+		devices = append(devices, device{"ads1015", ads1015Addr})
+	}
+	for _, d := range devices {
+		r.check("i2c "+d.name, prober.Probe(d.addr), "answers at %#x", d.addr)
+	}
+}
+
+// testSensors reads every sensor fitted.
+func (bot *Robot) testSensors(r *SelfTestReport) {
+	if bot.ranger != nil {
+		dist, err := bot.ranger.Range()
+		r.check("range", err, "%.2fm", dist)
+	}
+	if bot.imu != nil {
+		turned, err := bot.imu.Turned()
+		r.check("imu", err, "turned %.1f deg", turned*180/math.Pi)
+	}
+	if bot.battery != nil {
+		status, err := bot.Battery()
+		if err == nil && status.Charge < bot.cfg.Battery.Cutoff {
+			err = fmt.Errorf("%s at %.2fV", ErrBatteryLow.Error(), status.Volts)
+		}
+		r.check("battery", err, "%.2fV, %.0f%%", status.Volts, status.Charge*100)
+	}
+	if bot.encoders != nil {
+		for _, tr := range []TrackConfig{bot.cfg.Left, bot.cfg.Right} {
+			ticks, err := bot.encoders.Ticks(tr.Motor)
+			r.check(fmt.Sprintf("encoder %d", tr.Motor), err, "%d ticks", ticks)
+		}
+	}
+}
+
+// testMotor runs a DC motor or track forward then backward.  A track with
+// an encoder must travel the right way.
+func (bot *Robot) testMotor(name string) error {
+	var track *TrackConfig
+	if bot.encoders != nil && name == "left_track" {
+		track = &bot.cfg.Left
+	} else if bot.encoders != nil && name == "right_track" {
+		track = &bot.cfg.Right
+	}
+	for _, power := range []float64{selfTestPower, -selfTestPower} {
+		var before int64
+		if track != nil {
+			var err error
+			if before, err = bot.encoders.Ticks(track.Motor); err != nil {
+				return err
+			}
+		}
+		if err := bot.Actuate(name, power); err != nil {
+			return err
+		}
+		time.Sleep(selfTestRun)
+		if err := bot.Actuate(name, 0); err != nil {
+			return err
+		}
+		// let the track ramp down before it reverses
+		time.Sleep(selfTestRun / 2)
+		if track == nil {
+			continue
+		}
+		after, err := bot.encoders.Ticks(track.Motor)
+		if err != nil {
+			return err
+		}
+		ticks := after - before
+		if track.Invert {
+			ticks = -ticks
+		}
+		if ticks == 0 || (ticks > 0) != (power > 0) {
+			return fmt.Errorf("encoder counted %d ticks at power %g", ticks, power)
+		}
+	}
+	return nil
+}
+
+// waitActuator waits for an actuator to reach a value.
+func (bot *Robot) waitActuator(name string, value float64) error {
+	deadline := time.Now().Add(servoSettle)
+	for {
+		a, err := bot.Actuator(name)
+		if err != nil {
+			return err
+		}
+		if a.Value == value {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("stuck at %g short of %g", a.Value, value)
+		}
+		time.Sleep(podTick)
+	}
+}
+
+// testServo sweeps a servo to its limits and back to where it was.
+func (bot *Robot) testServo(a ActuatorState) error {
+	for _, deg := range []float64{a.Min, a.Max, a.Value} {
+		if err := bot.Actuate(a.Name, deg); err != nil {
+			return err
+		}
+		if err := bot.waitActuator(a.Name, deg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testStepper turns a stepper away and back to where it was, within its
+// limits.
+func (bot *Robot) testStepper(a ActuatorState) error {
+	away := a.Value + selfTestSteps
+	if a.Min < a.Max {
+		if away > a.Max {
+			away = a.Value - selfTestSteps
+		}
+		away = math.Max(a.Min, math.Min(a.Max, away))
+	}
+	for _, pos := range []float64{away, a.Value} {
+		if err := bot.Actuate(a.Name, pos); err != nil {
+			return err
+		}
+		if err := bot.waitActuator(a.Name, pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
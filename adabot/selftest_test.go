@@ -0,0 +1,78 @@
+package adabot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// failed returns the names of the failed checks.
+func failed(report SelfTestReport) (names []string) {
+	for _, res := range report.Results {
+		if !res.Pass {
+			names = append(names, res.Name)
+		}
+	}
+	return
+}
+
+func TestSelfTestSim(t *testing.T) {
+	cfg, err := LoadConfig("profiles/gripper.yaml")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cfg.Left.TicksPerMeter, cfg.Left.EncoderPin = 1200, "16"
+	cfg.Right.TicksPerMeter, cfg.Right.EncoderPin = 1200, "18"
+	cfg.Range.Sensor = "lidarlite"
+	cfg.Battery.Monitor = "ads1015"
+	cfg.IMU.Sensor = "mpu6050"
+	bot, sim := newSimRobotConfig(t, instant(cfg))
+	sim.AddWall(2, -1, 2, 1)
+
+	report := bot.SelfTest()
+	if !report.Pass {
+		t.Fatalf("Expected: pass, Got:\n%s", report)
+	}
+	// the I2C devices, the sensors then the actuators
+	if n := len(report.Results); n != 5+5+6 {
+		t.Errorf("Expected: 16 checks, Got:\n%s", report)
+	}
+	if !strings.Contains(report.String(), "PASS  servo gripper") {
+		t.Errorf("Expected: the gripper swept, Got:\n%s", report)
+	}
+	if cmds := sim.Commands(); len(cmds) == 0 {
+		t.Errorf("Expected: commands, Got: none\n")
+	}
+	if deg := bot.YawAngle(); deg != cfg.Yaw.center() {
+		t.Errorf("Expected: %d, Got: %d\n", cfg.Yaw.center(), deg)
+	}
+}
+
+func TestSelfTestFailures(t *testing.T) {
+	cfg := instant(DefaultConfig())
+	cfg.Battery.Monitor = "ads1015"
+	bot, sim := newSimRobotConfig(t, cfg)
+	sim.Unplug(0x60)
+	// flat
+	sim.SetBatteryVoltage(6)
+
+	report := bot.SelfTest()
+	if report.Pass {
+		t.Fatalf("Expected: fail, Got:\n%s", report)
+	}
+	// the tracks refuse to run on a flat battery
+	want := "[i2c motor hat battery dc left_track dc right_track]"
+	if got := fmt.Sprint(failed(report)); got != want {
+		t.Errorf("Expected: %s, Got: %v\n", want, got)
+	}
+}
+
+func TestSelfTestEStop(t *testing.T) {
+	bot, _ := newSimRobot(t)
+	bot.EStop()
+
+	report := bot.SelfTest()
+	if got := failed(report); len(got) != 1 || got[0] != "e-stop" {
+		t.Errorf("Expected: [e-stop], Got: %v\n", got)
+	}
+}
@@ -0,0 +1,414 @@
+package adabot
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	net "github.com/jfinken/gobot-lab/adabot/network"
+)
+
+// SimMaxRange is the farthest the simulated range sensor sees (in m), as
+// far as an HC-SR04.
+const SimMaxRange = 4.0
+
+const (
+	// simIdleAmps is the current drawn by the Pi and HATs (in A).
+	simIdleAmps = 0.4
+	// simMotorAmps is the current drawn by a DC motor at full speed (in A).
+	simMotorAmps = 1.2
+)
+
+// SimOp identifies the Drive method a SimCommand recorded.
+type SimOp string
+
+const (
+	SimSpeed SimOp = "speed"
+	SimRun   SimOp = "run"
+	SimFreq  SimOp = "freq"
+	SimPulse SimOp = "pulse"
+	SimStep  SimOp = "step"
+)
+
+// A SimCommand is a single timestamped call made against a SimDrive.  Only
+// the fields relevant to Op are set: Port is the DC motor number, the servo
+// channel or the stepper port.
+type SimCommand struct {
+	At    time.Time
+	Op    SimOp
+	Port  int
+	Speed int32
+	Dir   Direction
+	Pulse int32
+	Freq  float64
+	Style StepStyle
+}
+
+// SimMotor is the simulated state of one DC motor.
+type SimMotor struct {
+	Speed int32
+	Dir   Direction
+}
+
+// SimDrive is an in-process Drive that records every motor and servo
+// command so that tests and desktop builds can run without a Pi.  It also
+// moves a simulated chassis around, giving the true pose to check dead
+// reckoning against.
+type SimDrive struct {
+	mu       sync.Mutex
+	commands []SimCommand
+	motors   map[int]SimMotor
+	pulses   map[byte]int32
+	freq     float64
+
+	chassis Config          // track wiring and calibration of the simulated chassis
+	truth   odometry        // true pose of the simulated chassis
+	gains   map[int]float64 // true speed over calibrated speed, per motor
+	vel     map[int]float64 // signed speed of each motor since at (in m/s)
+	travel  map[int]float64 // signed travel of each motor (in m)
+	at      time.Time       // time the travel was integrated up to
+	walls   []simWall       // obstacles seen by the range sensor
+	scrub   float64         // true wheelbase over the calibrated one
+	drift   float64         // gyro drift (in rad/s)
+	drifted float64         // gyro drift up to driftAt (in rad)
+	driftAt time.Time
+	volts   float64      // battery voltage
+	absent  map[int]bool // I2C addresses that do not answer
+}
+
+// simWall is a straight obstacle from (x1, y1) to (x2, y2), in meters in
+// the frame of the true pose.
+type simWall struct {
+	x1, y1, x2, y2 float64
+}
+
+// NewSimDrive constructs a simulator with every motor released, on the
+// chassis of DefaultConfig.
+func NewSimDrive() *SimDrive {
+	s := &SimDrive{
+		motors: make(map[int]SimMotor),
+		pulses: make(map[byte]int32),
+		gains:  make(map[int]float64),
+		vel:    make(map[int]float64),
+		travel: make(map[int]float64),
+		at:     time.Now(),
+		scrub:  1,
+		volts:  8,
+		absent: make(map[int]bool),
+	}
+	s.driftAt = s.at
+	s.SetChassis(DefaultConfig())
+	return s
+}
+
+// SetChassis rebuilds the simulated chassis from cfg and puts it back at the
+// origin.  NewRobot does so with its own configuration.
+func (s *SimDrive) SetChassis(cfg *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chassis = *cfg
+	s.truth = newOdometry(cfg.Wheelbase*s.scrub, time.Now())
+	s.move()
+}
+
+// SetTurnScrub makes the simulated chassis turn as if its wheelbase were
+// factor times the calibrated one, e.g. 1.3 for treads that scrub sideways
+// when skid steering, so that the odometry overestimates its turns.
+func (s *SimDrive) SetTurnScrub(factor float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.move()
+	s.scrub = factor
+	s.truth.wheelbase = s.chassis.Wheelbase * factor
+}
+
+// SetGyroDrift makes the simulated IMU drift by rate (in rad/s) from now on.
+func (s *SimDrive) SetGyroDrift(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.drifted += s.drift * now.Sub(s.driftAt).Seconds()
+	s.drift, s.driftAt = rate, now
+}
+
+// Turned implements IMU: the true turn of the chassis plus the gyro drift.
+func (s *SimDrive) Turned() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.truth.advance(now)
+	return s.truth.turned + s.drifted + s.drift*now.Sub(s.driftAt).Seconds(), nil
+}
+
+// SetMotorGain makes the given DC motor run at gain times the calibrated
+// track speed, e.g. 0.8 for a motor weaker than its twin.
+func (s *SimDrive) SetMotorGain(motor int, gain float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gains[motor] = gain
+	s.move()
+}
+
+// motorSpeed returns the true speed of a motor (in m/s) from its state,
+// positive when running MotorForward.  The caller must hold s.mu.
+func (s *SimDrive) motorSpeed(motor int) float64 {
+	m := s.motors[motor]
+	v := float64(m.Speed) / maxSpeed * s.chassis.TrackSpeed
+	if gain, ok := s.gains[motor]; ok {
+		v *= gain
+	}
+	switch m.Dir {
+	case MotorForward:
+		return v
+	case MotorBackward:
+		return -v
+	}
+	return 0
+}
+
+// trackSpeed returns the true speed of a track (in m/s), positive forward.
+// The caller must hold s.mu.
+func (s *SimDrive) trackSpeed(track TrackConfig) float64 {
+	if track.Invert {
+		return -s.vel[track.Motor]
+	}
+	return s.vel[track.Motor]
+}
+
+// move integrates the motor travel and the true pose up to now then
+// carries on at the speeds the motors are set to.  The caller must hold
+// s.mu.
+func (s *SimDrive) move() {
+	now := time.Now()
+	dt := now.Sub(s.at).Seconds()
+	for motor, v := range s.vel {
+		s.travel[motor] += v * dt
+	}
+	s.at = now
+	for motor := range s.motors {
+		s.vel[motor] = s.motorSpeed(motor)
+	}
+	s.truth.setSpeeds(now, s.trackSpeed(s.chassis.Left), s.trackSpeed(s.chassis.Right))
+}
+
+// Ticks implements Encoders for the tracks of the simulated chassis with a
+// ticks_per_meter.
+func (s *SimDrive) Ticks(motor int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tpm float64
+	for _, track := range []TrackConfig{s.chassis.Left, s.chassis.Right} {
+		if track.Motor == motor {
+			tpm = track.TicksPerMeter
+		}
+	}
+	if tpm <= 0 {
+		return 0, fmt.Errorf("sim: no encoder on motor %d", motor)
+	}
+	s.move()
+	return int64(math.Floor(s.travel[motor] * tpm)), nil
+}
+
+// Pose returns the true pose of the simulated chassis.
+func (s *SimDrive) Pose() Pose {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truth.advance(time.Now())
+	return s.truth.pose
+}
+
+func (s *SimDrive) record(c SimCommand) {
+	c.At = time.Now()
+	s.commands = append(s.commands, c)
+}
+
+// SetDCMotorSpeed implements Drive.
+func (s *SimDrive) SetDCMotorSpeed(motor int, speed int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.motors[motor]
+	if !ok {
+		m.Dir = MotorRelease
+	}
+	m.Speed = speed
+	s.motors[motor] = m
+	s.move()
+	s.record(SimCommand{Op: SimSpeed, Port: motor, Speed: speed})
+	return nil
+}
+
+// RunDCMotor implements Drive.
+func (s *SimDrive) RunDCMotor(motor int, dir Direction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.motors[motor]
+	m.Dir = dir
+	s.motors[motor] = m
+	s.move()
+	s.record(SimCommand{Op: SimRun, Port: motor, Dir: dir})
+	return nil
+}
+
+// SetServoMotorFreq implements Drive.
+func (s *SimDrive) SetServoMotorFreq(freq float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.freq = freq
+	s.record(SimCommand{Op: SimFreq, Freq: freq})
+	return nil
+}
+
+// SetServoMotorPulse implements Drive.
+func (s *SimDrive) SetServoMotorPulse(channel byte, on, off int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pulses[channel] = off
+	s.record(SimCommand{Op: SimPulse, Port: int(channel), Pulse: off})
+	return nil
+}
+
+// OneStep implements Stepper.
+func (s *SimDrive) OneStep(port int, dir Direction, style StepStyle) error {
+	if port != 0 && port != 1 {
+		return fmt.Errorf("sim: no stepper port %d", port)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(SimCommand{Op: SimStep, Port: port, Dir: dir, Style: style})
+	return nil
+}
+
+// Commands returns a copy of every command recorded so far.
+func (s *SimDrive) Commands() []SimCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SimCommand(nil), s.commands...)
+}
+
+// Reset clears the recorded commands but keeps the simulated state.
+func (s *SimDrive) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = nil
+}
+
+// Motor returns the current simulated state of the given DC motor.
+func (s *SimDrive) Motor(motor int) SimMotor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.motors[motor]
+	if !ok {
+		m.Dir = MotorRelease
+	}
+	return m
+}
+
+// Pulse returns the last pulse written to the given servo channel.
+func (s *SimDrive) Pulse(channel byte) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pulses[channel]
+}
+
+// AddWall places a straight obstacle from (x1, y1) to (x2, y2), in meters
+// in the frame of Pose, for the range sensor to see.
+func (s *SimDrive) AddWall(x1, y1, x2, y2 float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.walls = append(s.walls, simWall{x1, y1, x2, y2})
+}
+
+// AddFloorplan places the edges of the wall polygons of plan as obstacles,
+// see AddWall, but for the noise the renderer leaves out too, see
+// Floorplan.IsWall.
+func (s *SimDrive) AddFloorplan(plan *net.Floorplan) {
+	m := plan.Meters()
+	wall := func(a, b []float64) { s.AddWall(a[0]*m, a[1]*m, b[0]*m, b[1]*m) }
+	for _, poly := range plan.Polygons {
+		if !plan.IsWall(poly) {
+			continue
+		}
+		n := len(poly.Verts)
+		for i := 1; i < n; i++ {
+			wall(poly.Verts[i-1], poly.Verts[i])
+		}
+		if poly.IsClosed && n > 2 {
+			wall(poly.Verts[n-1], poly.Verts[0])
+		}
+	}
+}
+
+// Range implements Ranger: the distance from the true pose to the nearest
+// wall straight ahead.
+func (s *SimDrive) Range() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truth.advance(time.Now())
+	p := s.truth.pose
+	dx, dy := math.Cos(p.Heading), math.Sin(p.Heading)
+	dist := math.Inf(1)
+	for _, w := range s.walls {
+		ex, ey := w.x2-w.x1, w.y2-w.y1
+		denom := dx*ey - dy*ex
+		if denom == 0 {
+			// parallel to the ray
+			continue
+		}
+		ox, oy := w.x1-p.X, w.y1-p.Y
+		t := (ox*ey - oy*ex) / denom // along the ray
+		u := (ox*dy - oy*dx) / denom // along the wall
+		if t >= 0 && u >= 0 && u <= 1 && t < dist {
+			dist = t
+		}
+	}
+	if dist > SimMaxRange {
+		return math.Inf(1), nil
+	}
+	return dist, nil
+}
+
+// SetBatteryVoltage sets the voltage of the simulated battery.
+func (s *SimDrive) SetBatteryVoltage(volts float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.volts = volts
+}
+
+// Voltage implements Battery.
+func (s *SimDrive) Voltage() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.volts, nil
+}
+
+// Current implements Battery: an idle draw plus that of the running motors
+// in proportion to their speed.
+func (s *SimDrive) Current() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	amps := simIdleAmps
+	for _, m := range s.motors {
+		if m.Dir == MotorForward || m.Dir == MotorBackward {
+			amps += simMotorAmps * float64(m.Speed) / maxSpeed
+		}
+	}
+	return amps, nil
+}
+
+// Unplug makes the I2C device at addr stop answering Probe.
+func (s *SimDrive) Unplug(addr int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.absent[addr] = true
+}
+
+// Probe implements Prober: every I2C device answers until unplugged.
+func (s *SimDrive) Probe(addr int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.absent[addr] {
+		return fmt.Errorf("sim: no i2c device at %#x", addr)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package adabot
+
+import (
+	"log"
+	"math"
+)
+
+// Encoders is implemented by a Drive that counts the wheel encoder ticks
+// of its DC motors.
+type Encoders interface {
+	// Ticks returns the count of encoder ticks of the given DC motor since
+	// startup, increasing while the motor runs MotorForward.
+	Ticks(motor int) (int64, error)
+}
+
+// pid is a PID controller.
+type pid struct {
+	cfg      PIDConfig
+	integral float64
+	prevErr  float64
+	primed   bool // prevErr is set
+}
+
+// update returns the control output for the error after dt seconds.  The
+// integral is bounded so that it alone never asks for more than full power.
+func (p *pid) update(err, dt float64) float64 {
+	out := p.cfg.Kp * err
+	if p.cfg.Ki > 0 {
+		limit := 1 / p.cfg.Ki
+		p.integral = math.Max(-limit, math.Min(limit, p.integral+err*dt))
+		out += p.cfg.Ki * p.integral
+	}
+	if p.primed && dt > 0 {
+		out += p.cfg.Kd * (err - p.prevErr) / dt
+	}
+	p.prevErr, p.primed = err, true
+	return out
+}
+
+func (p *pid) reset() {
+	p.integral, p.prevErr, p.primed = 0, 0, false
+}
+
+// closedLoop reports whether the track speeds are regulated from encoders.
+func (bot *Robot) closedLoop() bool {
+	return bot.encoders != nil
+}
+
+// trackTravel returns how far the track moved (in m) since the last call.
+// The caller must hold bot.mu.
+func (bot *Robot) trackTravel(tr *track) (float64, error) {
+	ticks, err := bot.encoders.Ticks(tr.cfg.Motor)
+	if err != nil {
+		return 0, err
+	}
+	delta := ticks - tr.ticks
+	tr.ticks = ticks
+	if tr.cfg.Invert {
+		delta = -delta
+	}
+	return float64(delta) / tr.cfg.TicksPerMeter, nil
+}
+
+// regulate runs one step of the speed controller dt seconds after the last:
+// the encoder travel of both tracks feeds the pose estimate, then each
+// track is driven toward its setpoint, the fraction of TrackSpeed the ramp
+// has reached.  It reports whether either track is still running.  The
+// caller must hold bot.mu.
+func (bot *Robot) regulate(dt float64) (running bool) {
+	var dist [2]float64
+	tracks := []*track{&bot.left, &bot.right}
+	for i, tr := range tracks {
+		d, err := bot.trackTravel(tr)
+		if err != nil {
+			log.Printf("%s\n", err.Error())
+			return true
+		}
+		dist[i] = d
+	}
+	bot.odom.travel(dist[0], dist[1])
+
+	for i, tr := range tracks {
+		setpoint := tr.power * bot.cfg.TrackSpeed
+		out := 0.0
+		if setpoint == 0 {
+			tr.pid.reset()
+		} else if dt > 0 {
+			// feed forward the open-loop power, correct for the speed error
+			out = clampPower(tr.power + tr.pid.update(setpoint-dist[i]/dt, dt))
+		} else {
+			out = tr.out
+		}
+		if out != tr.out {
+			if err := bot.runTrack(tr.cfg, out); err != nil {
+				log.Printf("%s\n", err.Error())
+			}
+			tr.out = out
+		}
+		if setpoint != 0 || out != 0 {
+			running = true
+		}
+	}
+	return
+}
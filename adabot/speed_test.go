@@ -0,0 +1,95 @@
+package adabot
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPIDUpdate(t *testing.T) {
+	p := pid{cfg: PIDConfig{Kp: 2, Ki: 1, Kd: 0.5}}
+	// 2*0.5 + 1*0.05 on the first update, no derivative yet
+	if got := p.update(0.5, 0.1); math.Abs(got-1.05) > 1e-9 {
+		t.Errorf("Expected: 1.05, Got: %g\n", got)
+	}
+	// 2*0.3 + 1*0.08 + 0.5*(-0.2/0.1)
+	if got := p.update(0.3, 0.1); math.Abs(got-(-0.32)) > 1e-9 {
+		t.Errorf("Expected: -0.32, Got: %g\n", got)
+	}
+	// the integral alone is bounded to full power
+	for i := 0; i < 100; i++ {
+		p.update(1, 1)
+	}
+	if p.integral != 1 {
+		t.Errorf("Expected: 1, Got: %g\n", p.integral)
+	}
+	p.reset()
+	if p.integral != 0 || p.primed {
+		t.Errorf("Expected: reset, Got: %+v\n", p)
+	}
+}
+
+func newEncoderRobot(t *testing.T) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.Left.TicksPerMeter = 1200
+	cfg.Right.TicksPerMeter = 1200
+	bot, sim := newSimRobotConfig(t, cfg)
+	if !bot.closedLoop() {
+		t.Fatalf("Expected: closed-loop, Got: open-loop\n")
+	}
+	return bot, sim
+}
+
+// trackSpeeds measures the true speed of both tracks of the default chassis
+// over the given period.
+func trackSpeeds(sim *SimDrive, period time.Duration) (left, right float64) {
+	l0, _ := sim.Ticks(3)
+	r0, _ := sim.Ticks(2)
+	time.Sleep(period)
+	l1, _ := sim.Ticks(3)
+	r1, _ := sim.Ticks(2)
+	// both tracks are wired flipped
+	sec := period.Seconds()
+	return -float64(l1-l0) / 1200 / sec, -float64(r1-r0) / 1200 / sec
+}
+
+func TestSpeedControlMotorMismatch(t *testing.T) {
+	bot, sim := newEncoderRobot(t)
+	sim.SetMotorGain(3, 0.7)
+
+	if err := bot.DriveAt(0.2, 0.2, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	time.Sleep(500 * time.Millisecond)
+	left, right := trackSpeeds(sim, 300*time.Millisecond)
+	for _, v := range []float64{left, right} {
+		if math.Abs(v-0.2) > 0.02 {
+			t.Errorf("Expected: 0.2 m/s on both tracks, Got: %g %g\n", left, right)
+			break
+		}
+	}
+	bot.Stop()
+	waitRamp(t, bot, time.Second)
+	for _, port := range []int{2, 3} {
+		if m := sim.Motor(port); m.Dir != MotorRelease {
+			t.Errorf("Expected: motor %d released, Got: %s\n", port, m.Dir)
+		}
+	}
+}
+
+func TestSpeedControlPose(t *testing.T) {
+	bot, sim := newEncoderRobot(t)
+	sim.SetMotorGain(2, 0.8)
+
+	bot.DriveAt(0.2, 0.2, 0.5)
+	time.Sleep(700 * time.Millisecond)
+	waitRamp(t, bot, time.Second)
+	est, truth := bot.Pose(), sim.Pose()
+	if !posesClose(est, truth, 0.02) {
+		t.Errorf("Expected: %+v, Got: %+v\n", truth, est)
+	}
+	// open-loop, the weak right track would have pulled ~0.3rad to the right
+	if math.Abs(truth.Heading) > 0.1 || math.Abs(truth.X-0.1) > 0.02 {
+		t.Errorf("Expected: about 0.1m straight ahead, Got: %+v\n", truth)
+	}
+}
@@ -0,0 +1,123 @@
+package adabot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Stepper is implemented by a Drive that drives stepper motors.
+type Stepper interface {
+	// OneStep energizes the coils of the stepper on the given port for its
+	// next step in the given direction and style: a full step, or a half
+	// step when interleaved.
+	OneStep(port int, dir Direction, style StepStyle) error
+}
+
+// stepperMotor is the state of one stepper motor.
+type stepperMotor struct {
+	cfg    StepperConfig
+	invert bool
+	mu     sync.Mutex // held by the step in progress
+	pos    int64      // position (in half steps), guarded by bot.mu
+}
+
+// step turns the stepper motor, see Step.
+func (bot *Robot) step(m *stepperMotor, steps int, dir Direction, style StepStyle, rpm int) error {
+	if bot.EStopped() {
+		return ErrEStop
+	}
+	if steps < 0 {
+		return fmt.Errorf("step: %d steps must not be negative", steps)
+	}
+	if dir != MotorForward && dir != MotorBackward {
+		return fmt.Errorf("step: cannot step %s", dir)
+	}
+	if style < StepSingle || style > StepMicrostep {
+		return fmt.Errorf("step: unknown step style %d", style)
+	}
+	if rpm <= 0 {
+		rpm = m.cfg.RPM
+	}
+	interval := time.Minute / time.Duration(m.cfg.StepsPerRev*rpm)
+	half := int64(2)
+	if style == StepInterleave {
+		interval /= 2
+		half = 1
+	}
+	if dir == MotorBackward {
+		half = -half
+	}
+	wired := dir
+	if m.invert {
+		wired = MotorForward + MotorBackward - dir
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := time.Now()
+	for i := 0; i < steps; i++ {
+		if bot.EStopped() {
+			return ErrEStop
+		}
+		if err := bot.stepper.OneStep(m.cfg.Port, wired, style); err != nil {
+			return err
+		}
+		bot.mu.Lock()
+		m.pos += half
+		bot.mu.Unlock()
+		next = next.Add(interval)
+		time.Sleep(time.Until(next))
+	}
+	return nil
+}
+
+// stepTo turns the stepper motor to the given position (in full steps) in
+// double steps, rounded to the nearest half step.
+func (bot *Robot) stepTo(m *stepperMotor, pos float64) error {
+	bot.mu.Lock()
+	delta := int(math.Round(pos*2)) - int(m.pos)
+	bot.mu.Unlock()
+	dir := MotorForward
+	if delta < 0 {
+		dir, delta = MotorBackward, -delta
+	}
+	// a half step first when off the full steps
+	if delta%2 == 1 {
+		if err := bot.step(m, 1, dir, StepInterleave, 0); err != nil {
+			return err
+		}
+	}
+	return bot.step(m, delta/2, dir, StepDouble, 0)
+}
+
+// position returns the position of the stepper motor (in full steps).
+func (bot *Robot) position(m *stepperMotor) float64 {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	return float64(m.pos) / 2
+}
+
+// Step turns the stepper by the given number of steps in the given
+// direction, MotorForward or MotorBackward, and style, at the given speed
+// (in RPM), or at the configured speed when rpm is not positive.  As on the
+// Adafruit Motor HAT, interleaved steps are half steps and microsteps add
+// up to full steps.  It returns once done, and fails with ErrEStop as soon
+// as the e-stop latches.  Steps wait for the ones in progress.
+func (bot *Robot) Step(steps int, dir Direction, style StepStyle, rpm int) error {
+	if bot.stepMotor == nil {
+		return errors.New("no stepper fitted")
+	}
+	return bot.step(bot.stepMotor, steps, dir, style, rpm)
+}
+
+// StepperPosition returns how far the stepper turned forward (in full
+// steps) since startup.
+func (bot *Robot) StepperPosition() float64 {
+	if bot.stepMotor == nil {
+		return 0
+	}
+	return bot.position(bot.stepMotor)
+}
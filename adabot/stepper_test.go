@@ -0,0 +1,111 @@
+package adabot
+
+import (
+	"testing"
+	"time"
+)
+
+func newStepperRobot(t *testing.T, rpm int) (*Robot, *SimDrive) {
+	cfg := DefaultConfig()
+	cfg.Stepper = StepperConfig{Port: 0, StepsPerRev: 200, RPM: rpm}
+	return newSimRobotConfig(t, cfg)
+}
+
+// stepCommands returns the steps recorded by the simulator.
+func stepCommands(sim *SimDrive) (steps []SimCommand) {
+	for _, cmd := range sim.Commands() {
+		if cmd.Op == SimStep {
+			steps = append(steps, cmd)
+		}
+	}
+	return
+}
+
+func TestStep(t *testing.T) {
+	bot, sim := newStepperRobot(t, 600)
+
+	if err := bot.Step(10, MotorForward, StepDouble, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := bot.Step(3, MotorBackward, StepInterleave, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	steps := stepCommands(sim)
+	if len(steps) != 13 {
+		t.Fatalf("Expected: 13 steps, Got: %d\n", len(steps))
+	}
+	if s := steps[0]; s.Port != 0 || s.Dir != MotorForward || s.Style != StepDouble {
+		t.Errorf("Expected: port 0 forward double, Got: %+v\n", s)
+	}
+	if s := steps[12]; s.Dir != MotorBackward || s.Style != StepInterleave {
+		t.Errorf("Expected: backward interleave, Got: %+v\n", s)
+	}
+	if pos := bot.StepperPosition(); pos != 8.5 {
+		t.Errorf("Expected: 8.5, Got: %g\n", pos)
+	}
+}
+
+func TestStepRPM(t *testing.T) {
+	bot, _ := newStepperRobot(t, 600)
+
+	// 5ms per step at 60rpm
+	start := time.Now()
+	if err := bot.Step(20, MotorForward, StepSingle, 60); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d := time.Since(start); d < 95*time.Millisecond || d > 300*time.Millisecond {
+		t.Errorf("Expected: 100ms, Got: %s\n", d)
+	}
+}
+
+func TestStepEStop(t *testing.T) {
+	bot, sim := newStepperRobot(t, 60)
+
+	done := make(chan error)
+	go func() { done <- bot.Step(200, MotorForward, StepSingle, 0) }()
+	time.Sleep(50 * time.Millisecond)
+	bot.EStop()
+	select {
+	case err := <-done:
+		if err != ErrEStop {
+			t.Errorf("Expected: %v, Got: %v\n", ErrEStop, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected: the step to stop at the e-stop\n")
+	}
+	n := len(stepCommands(sim))
+	if n == 0 || n == 200 {
+		t.Errorf("Expected: some steps, Got: %d\n", n)
+	}
+	if err := bot.Step(1, MotorForward, StepSingle, 0); err != ErrEStop {
+		t.Errorf("Expected: %v, Got: %v\n", ErrEStop, err)
+	}
+}
+
+func TestStepInvalid(t *testing.T) {
+	bot, sim := newSimRobot(t)
+	if err := bot.Step(1, MotorForward, StepSingle, 0); err == nil {
+		t.Errorf("Expected: no stepper fitted, Got: nil\n")
+	}
+	bot, sim = newStepperRobot(t, 600)
+	if err := bot.Step(1, MotorRelease, StepSingle, 0); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+	if err := bot.Step(-1, MotorForward, StepSingle, 0); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+	if steps := stepCommands(sim); len(steps) != 0 {
+		t.Errorf("Expected: no steps, Got: %+v\n", steps)
+	}
+}
+
+func TestParseStepStyle(t *testing.T) {
+	for _, s := range []StepStyle{StepSingle, StepDouble, StepInterleave, StepMicrostep} {
+		if got, err := ParseStepStyle(s.String()); err != nil || got != s {
+			t.Errorf("Expected: %s, Got: %s %v\n", s, got, err)
+		}
+	}
+	if _, err := ParseStepStyle("wave"); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+}
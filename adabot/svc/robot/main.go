@@ -2,10 +2,13 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -26,50 +29,93 @@ func HealthHandler(ctx *gin.Context) {
 }
 
 // TreadHandler is the handler that is expected to receive a direction and duration in seconds.
+// Without a duration the treads run until the next command.  The optional throttle query
+// parameter is the fraction of full speed, 0 to 1, and defaults to full speed.
 // examples:
 //  curl host:8181/api/v1/tread/dir/stop
 //  curl host:8181/api/v1/tread/dir/forward
 //  curl host:8181/api/v1/tread/dir/left
 //  curl host:8181/api/v1/tread/dir/right
 //  curl host:8181/api/v1/tread/dir/backward
+//  curl host:8181/api/v1/tread/dir/forward/duration/0.5
+//  curl host:8181/api/v1/tread/dir/forward/duration/0.5?throttle=0.6
 func TreadHandler(ctx *gin.Context) {
 	dir := ctx.Param("dir")
-	//duration := ctx.Param("dur")
+	duration := ctx.Param("dur")
 
-	/*
-		sec, err := strconv.Atoi(duration)
-		if err != nil {
-			errMsg := fmt.Sprintf("PARAM: %s", err.Error())
+	var sec float64
+	var err error
+	if duration != "" {
+		if sec, err = strconv.ParseFloat(duration, 64); err != nil || sec < 0 {
+			errMsg := fmt.Sprintf("PARAM: invalid duration: %s", duration)
 			ctx.String(http.StatusBadRequest, errMsg)
 			return
 		}
-	*/
-	// TODO: validate the directions
-	noop := -1
+	}
+	throttle, err := strconv.ParseFloat(ctx.DefaultQuery("throttle", "1"), 64)
+	if err != nil {
+		errMsg := fmt.Sprintf("PARAM: %s", err.Error())
+		ctx.String(http.StatusBadRequest, errMsg)
+		return
+	}
 	switch dir {
 	case "stop":
-		bot.Stop()
+		err = bot.Stop()
 	case "forward":
-		bot.Forward(noop)
+		err = bot.Forward(sec, throttle)
 	case "backward":
-		bot.Backward(noop)
+		err = bot.Backward(sec, throttle)
 	case "left":
-		bot.Left(noop)
+		err = bot.Left(sec, throttle)
 	case "right":
-		bot.Right(noop)
+		err = bot.Right(sec, throttle)
+	default:
+		ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid direction: %s", dir))
+		return
+	}
+	if err == adabot.ErrEStop {
+		ctx.String(http.StatusConflict, "E-stop latched.\n")
+		return
+	}
+	if err == adabot.ErrObstacle {
+		ctx.String(http.StatusConflict, "Obstacle ahead.\n")
+		return
+	}
+	if err == adabot.ErrBatteryLow {
+		ctx.String(http.StatusConflict, "Battery low.\n")
+		return
+	}
+	if err != nil {
+		log.Printf("Tread err: %s\n", err.Error())
+		ctx.String(http.StatusInternalServerError, "Tread err.\n")
+		return
 	}
-	//ctx.String(http.StatusOK, fmt.Sprintf("dir: %s, duration: %s\n", dir, duration))
-	ctx.String(http.StatusOK, fmt.Sprintf("dir: %s\n", dir))
+	ctx.String(http.StatusOK, fmt.Sprintf("dir: %s, duration: %g, throttle: %g\n", dir, sec, throttle))
+}
+
+// KeepaliveHandler feeds the robot's deadman watchdog.  Clients holding a tread
+// direction down are expected to call it well within the configured timeout.
+//  curl host:8181/api/v1/keepalive
+func KeepaliveHandler(ctx *gin.Context) {
+	bot.Keepalive()
+	ctx.String(http.StatusOK, "ok\n")
 }
 
 // ServoHandler handles requests to control the two servo motors charged with yaw/pitch
-// direction of the phone/camera pod.
+// direction of the phone/camera pod.  The func form nudges the servo by the configured
+// increase, the deg form moves it to an absolute angle.  Both are clamped to the soft
+// limits and reply with the resulting angles.
 //  curl host:8181/api/v1/pod/dir/yaw/func/-1
 //  curl host:8181/api/v1/pod/dir/pitch/func/1
+//  curl host:8181/api/v1/pod/dir/yaw/deg/45
 func ServoHandler(ctx *gin.Context) {
 	dir := ctx.Param("dir")
-	// fn is expected to be a signed int
+	// fn is expected to be a signed int, deg an angle
 	f := ctx.Param("func")
+	absolute := f == ""
+	if absolute {
+		f = ctx.Param("deg")
+	}
 
 	fn, err := strconv.Atoi(f)
 	if err != nil {
@@ -77,13 +123,195 @@ func ServoHandler(ctx *gin.Context) {
 		ctx.String(http.StatusBadRequest, errMsg)
 		return
 	}
-	switch dir {
-	case "yaw":
-		bot.Yaw(fn)
-	case "pitch":
-		bot.Pitch(fn)
+	switch {
+	case (dir == "yaw" || dir == "pitch") && absolute:
+		err = bot.Actuate(dir, float64(fn))
+	case dir == "yaw":
+		err = bot.Yaw(fn)
+	case dir == "pitch":
+		err = bot.Pitch(fn)
+	default:
+		ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid direction: %s", dir))
+		return
+	}
+	if err == adabot.ErrEStop {
+		ctx.String(http.StatusConflict, "E-stop latched.\n")
+		return
+	}
+	if err != nil {
+		log.Printf("Servo err: %s\n", err.Error())
+		ctx.String(http.StatusInternalServerError, "Servo err.\n")
+		return
+	}
+	ctx.String(http.StatusOK, fmt.Sprintf("dir: %s, func: %d, yaw: %d, pitch: %d\n",
+		dir, fn, bot.YawAngle(), bot.PitchAngle()))
+}
+
+// PodHandler reports the current yaw/pitch angles of the phone/camera pod as JSON.
+//  curl host:8181/api/v1/pod
+func PodHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"yaw": bot.YawAngle(), "pitch": bot.PitchAngle()})
+}
+
+// PoseHandler reports the dead reckoned pose of the robot as JSON: x and y in
+// meters from where it started, heading in radians, and the heading fused
+// with the IMU.
+//  curl host:8181/api/v1/pose
+func PoseHandler(ctx *gin.Context) {
+	pose := bot.Pose()
+	ctx.JSON(http.StatusOK, gin.H{"x": pose.X, "y": pose.Y, "heading": pose.Heading,
+		"fused_heading": bot.Heading()})
+}
+
+// RangeHandler reports the distance to the nearest obstacle ahead (in m) as
+// JSON, null when nothing is in range.
+//  curl host:8181/api/v1/range
+func RangeHandler(ctx *gin.Context) {
+	dist, err := bot.Range()
+	if err != nil {
+		log.Printf("Range err: %s\n", err.Error())
+		ctx.String(http.StatusInternalServerError, "Range err.\n")
+		return
+	}
+	if math.IsInf(dist, 1) {
+		ctx.JSON(http.StatusOK, gin.H{"range": nil})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"range": dist})
+}
+
+// BatteryHandler reports the battery as JSON: volts, amps drawn and the
+// estimated charge, 0 to 1.
+//  curl host:8181/api/v1/battery
+func BatteryHandler(ctx *gin.Context) {
+	status, err := bot.Battery()
+	if err != nil {
+		log.Printf("Battery err: %s\n", err.Error())
+		ctx.String(http.StatusInternalServerError, "Battery err.\n")
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
+
+// StepperHandler turns the stepper motor by the given number of steps and
+// returns once done, then reports its position (in full steps) as JSON.  The
+// optional style query parameter is single (the default), double, interleave
+// or microstep, rpm defaults to the configured speed.
+//  curl host:8181/api/v1/stepper
+//  curl host:8181/api/v1/stepper/dir/forward/steps/50
+//  curl host:8181/api/v1/stepper/dir/backward/steps/100?style=microstep&rpm=10
+func StepperHandler(ctx *gin.Context) {
+	if dir, steps := ctx.Param("dir"), ctx.Param("steps"); dir != "" {
+		n, err := strconv.Atoi(steps)
+		if err != nil || n < 0 {
+			ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid steps: %s", steps))
+			return
+		}
+		var d adabot.Direction
+		switch dir {
+		case "forward":
+			d = adabot.MotorForward
+		case "backward":
+			d = adabot.MotorBackward
+		default:
+			ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid direction: %s", dir))
+			return
+		}
+		style, err := adabot.ParseStepStyle(ctx.DefaultQuery("style", "single"))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: %s", err.Error()))
+			return
+		}
+		rpm, err := strconv.Atoi(ctx.DefaultQuery("rpm", "0"))
+		if err != nil {
+			ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: %s", err.Error()))
+			return
+		}
+		err = bot.Step(n, d, style, rpm)
+		if err == adabot.ErrEStop {
+			ctx.String(http.StatusConflict, "E-stop latched.\n")
+			return
+		}
+		if err != nil {
+			log.Printf("Stepper err: %s\n", err.Error())
+			ctx.String(http.StatusInternalServerError, "Stepper err.\n")
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"position": bot.StepperPosition()})
+}
+
+// ActuatorHandler sets the named actuator to the given value, see
+// adabot.Robot.Actuate, then reports its state as JSON.  Without a name it
+// reports every actuator.
+//  curl host:8181/api/v1/actuator
+//  curl host:8181/api/v1/actuator/gripper
+//  curl host:8181/api/v1/actuator/gripper/value/90
+func ActuatorHandler(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if name == "" {
+		ctx.JSON(http.StatusOK, bot.Actuators())
+		return
 	}
-	ctx.String(http.StatusOK, fmt.Sprintf("dir: %s, func: %d\n", dir, fn))
+	state, err := bot.Actuator(name)
+	if err != nil {
+		ctx.String(http.StatusNotFound, fmt.Sprintf("PARAM: %s", err.Error()))
+		return
+	}
+	if value := ctx.Param("value"); value != "" {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid value: %s", value))
+			return
+		}
+		if err = bot.Actuate(name, v); err == adabot.ErrEStop {
+			ctx.String(http.StatusConflict, "E-stop latched.\n")
+			return
+		} else if err != nil {
+			log.Printf("Actuator err: %s\n", err.Error())
+			ctx.String(http.StatusInternalServerError, "Actuator err.\n")
+			return
+		}
+		state, _ = bot.Actuator(name)
+	}
+	ctx.JSON(http.StatusOK, state)
+}
+
+// SelfTestHandler runs the self-test, which exercises every actuator and
+// reads every sensor, and reports it as JSON.  It answers HTTP-200 when the
+// self-test passes, HTTP-503 otherwise.  The robot moves!
+//  curl host:8181/api/v1/selftest
+func SelfTestHandler(ctx *gin.Context) {
+	report := bot.SelfTest()
+	status := http.StatusOK
+	if !report.Pass {
+		log.Printf("Self-test failed:\n%s", report)
+		status = http.StatusServiceUnavailable
+	}
+	ctx.JSON(status, report)
+}
+
+// EStopHandler latches or resets the e-stop and reports its state as JSON.
+// While latched the motors are released, the pod is frozen and tread and
+// pod commands are rejected with HTTP-409 until an explicit reset.
+//  curl host:8181/api/v1/estop
+//  curl host:8181/api/v1/estop/latch
+//  curl host:8181/api/v1/estop/reset
+func EStopHandler(ctx *gin.Context) {
+	switch action := ctx.Param("action"); action {
+	case "":
+	case "latch":
+		if err := bot.EStop(); err != nil {
+			// the latch holds even if a motor could not be released
+			log.Printf("E-stop err: %s\n", err.Error())
+		}
+	case "reset":
+		bot.ResetEStop()
+	default:
+		ctx.String(http.StatusBadRequest, fmt.Sprintf("PARAM: invalid action: %s", action))
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"estop": bot.EStopped()})
 }
 
 // RenderNetworkHandler handles requests to display the road network, given the netid, in SVG.
@@ -128,12 +356,19 @@ func StoreNetworkHandler(ctx *gin.Context) {
 
 // StorePlanHandler stores the bound json floorplan
 // curl -H "Content-Type: application/json" --data @body.json http://localhost:8181/api/v1/floorplan/:planid"
+// Append ?scale=0.01, say, when the vertices are in cm rather than meters.
 func StorePlanHandler(ctx *gin.Context) {
 	var polys []net.Polygon
 	planID := ctx.Param("planid")
+	// the vertices are in meters unless scale gives the size of their unit
+	scale, err := strconv.ParseFloat(ctx.DefaultQuery("scale", "0"), 64)
+	if err != nil || scale < 0 {
+		ctx.String(http.StatusBadRequest, fmt.Sprintf("Plan Store err: bad scale\n"))
+		return
+	}
 	// This will infer what binder to use, and unmarshal, depending on the content-type header
 	if ctx.Bind(&polys) == nil {
-		plan := &net.Floorplan{Polygons: polys}
+		plan := &net.Floorplan{Polygons: polys, Scale: scale}
 		err := plan.Store(planID)
 		if err != nil {
 			log.Printf("Plan Store err: %s\n", err.Error())
@@ -194,20 +429,129 @@ func wsHandler(ctx *gin.Context) {
 		conn.WriteMessage(t, []byte(buf.String()))
 	}
 }
+
+// telemetryPeriod is the interval at which telemetryHandler pushes a
+// snapshot of the robot.
+const telemetryPeriod = 500 * time.Millisecond
+
+// telemetryHandler upgrades the gin connection and writes a JSON snapshot of
+// the robot (pose, heading, range, battery, e-stop and pod) to the socket
+// every telemetryPeriod until the client goes away.
+func telemetryHandler(ctx *gin.Context) {
+	conn, err := wsupgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		fmt.Printf("Failed to set websocket upgrade: %+v\n", err)
+		return
+	}
+	defer conn.Close()
+	// notice the client closing the socket
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(telemetryPeriod)
+	defer ticker.Stop()
+	for {
+		if err := conn.WriteJSON(bot.Telemetry()); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-closed:
+			return
+		}
+	}
+}
+
+// actuatorCommand is a message of actuatorWSHandler, e.g.
+// {"name": "gripper", "value": 90}.
+type actuatorCommand struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// actuatorWSHandler upgrades the gin connection, then sets the named
+// actuator of every JSON command it reads, and replies with the state of the
+// actuator, or with the error.
+func actuatorWSHandler(ctx *gin.Context) {
+	conn, err := wsupgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		fmt.Printf("Failed to set websocket upgrade: %+v\n", err)
+		return
+	}
+	defer conn.Close()
+	for {
+		var cmd actuatorCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		var reply interface{}
+		if err := bot.Actuate(cmd.Name, cmd.Value); err != nil {
+			reply = gin.H{"name": cmd.Name, "error": err.Error()}
+		} else {
+			reply, _ = bot.Actuator(cmd.Name)
+		}
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+// newSimDrive returns a simulator whose range sensor sees the walls of the
+// floorplan stored at planID, if any.
+func newSimDrive(planID string) (*adabot.SimDrive, error) {
+	sim := adabot.NewSimDrive()
+	if planID == "" {
+		return sim, nil
+	}
+	var plan *net.Floorplan
+	plan, err := plan.Load(planID)
+	if err != nil {
+		return nil, err
+	}
+	sim.AddFloorplan(plan)
+	return sim, nil
+}
+
 func main() {
+	sim := flag.Bool("sim", false, "drive the in-process simulator instead of the motor HAT")
+	profile := flag.String("config", "", "robot profile (YAML or JSON), defaults to the original chassis")
+	planID := flag.String("plan", "", "stored floorplan whose walls the simulator's range sensor sees")
+	flag.Parse()
 
 	router := gin.Default()
 	router.Use(gin.Logger())
 
 	router.GET("/health", HealthHandler)
-	//router.GET("/api/v1/tread/dir/:dir/duration/:dur", TreadHandler)
+	router.GET("/api/v1/tread/dir/:dir/duration/:dur", TreadHandler)
 	router.GET("/api/v1/tread/dir/:dir", TreadHandler)
+	router.GET("/api/v1/keepalive", KeepaliveHandler)
+	router.GET("/api/v1/pod", PodHandler)
 	router.GET("/api/v1/pod/dir/:dir/func/:func", ServoHandler)
+	router.GET("/api/v1/pod/dir/:dir/deg/:deg", ServoHandler)
+	router.GET("/api/v1/pose", PoseHandler)
+	router.GET("/api/v1/range", RangeHandler)
+	router.GET("/api/v1/battery", BatteryHandler)
+	router.GET("/api/v1/stepper", StepperHandler)
+	router.GET("/api/v1/stepper/dir/:dir/steps/:steps", StepperHandler)
+	router.GET("/api/v1/actuator", ActuatorHandler)
+	router.GET("/api/v1/actuator/:name", ActuatorHandler)
+	router.GET("/api/v1/actuator/:name/value/:value", ActuatorHandler)
+	router.GET("/api/v1/selftest", SelfTestHandler)
+	router.GET("/api/v1/estop", EStopHandler)
+	router.GET("/api/v1/estop/:action", EStopHandler)
 	router.GET("/api/v1/network/:netid", RenderNetworkHandler)
 	router.POST("/api/v1/network/:netid", StoreNetworkHandler)
 	router.GET("/api/v1/floorplan/:planid", RenderPlanHandler)
 	router.POST("/api/v1/floorplan/:planid", StorePlanHandler)
 	router.GET("/ws", wsHandler)
+	router.GET("/ws/telemetry", telemetryHandler)
+	router.GET("/ws/actuator", actuatorWSHandler)
 	router.LoadHTMLGlob("./html/*.html")
 	router.GET("/", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "index.html", nil)
@@ -217,7 +561,25 @@ func main() {
 	})
 	router.Static("/html", "./html") // to serve local js and css files
 
-	robot, err := adabot.NewRobot()
+	var err error
+	cfg := adabot.DefaultConfig()
+	if *profile != "" {
+		if cfg, err = adabot.LoadConfig(*profile); err != nil {
+			log.Printf(err.Error())
+			return
+		}
+	}
+	var drive adabot.Drive
+	if *sim {
+		if drive, err = newSimDrive(*planID); err != nil {
+			log.Printf(err.Error())
+			return
+		}
+	} else if drive, err = adabot.NewHatDrive(cfg); err != nil {
+		log.Printf(err.Error())
+		return
+	}
+	robot, err := adabot.NewRobot(drive, cfg)
 	if err != nil {
 		log.Printf(err.Error())
 		return
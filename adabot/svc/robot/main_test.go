@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	net "github.com/jfinken/gobot-lab/adabot/network"
+)
+
+func TestSimDriveStoredPlan(t *testing.T) {
+	// stored by an earlier run of the service: a wall 1m ahead
+	plan := net.Floorplan{Polygons: []net.Polygon{{
+		Area: 0.4, Layer: net.Wall, IsClosed: true,
+		Verts: [][]float64{{1, -1}, {1.2, -1}, {1.2, 1}, {1, 1}},
+	}}}
+	content, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	path := "./.cache.simtest.json"
+	if err = ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer os.Remove(path)
+
+	sim, err := newSimDrive("simtest")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d, _ := sim.Range(); math.Abs(d-1) > 1e-9 {
+		t.Errorf("Expected: 1m, Got: %gm\n", d)
+	}
+	if _, err = newSimDrive("nosuchplan"); err == nil {
+		t.Errorf("Expected: error, Got: nil\n")
+	}
+}
@@ -0,0 +1,57 @@
+package adabot
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// Telemetry is a snapshot of the state of the robot, as streamed to the
+// web clients.
+type Telemetry struct {
+	Time time.Time `json:"time"`
+	Pose Pose      `json:"pose"`
+	// Heading is the fused heading, see Heading.
+	Heading float64 `json:"heading"`
+	// Range is nil without a range sensor or with nothing in range.
+	Range *float64 `json:"range"`
+	// Battery is nil without a battery monitor.
+	Battery *BatteryStatus `json:"battery"`
+	EStop   bool           `json:"estop"`
+	Yaw     int            `json:"yaw"`
+	Pitch   int            `json:"pitch"`
+	// Actuators holds the value of every actuator by name, see Actuate.
+	Actuators map[string]float64 `json:"actuators"`
+}
+
+// Telemetry reads the sensors fitted and returns a snapshot of the robot.
+// A sensor that fails is logged and left out.
+func (bot *Robot) Telemetry() Telemetry {
+	t := Telemetry{
+		Time:    time.Now(),
+		Pose:    bot.Pose(),
+		Heading: bot.Heading(),
+		EStop:   bot.EStopped(),
+		Yaw:     bot.YawAngle(),
+		Pitch:   bot.PitchAngle(),
+	}
+	t.Actuators = make(map[string]float64, len(bot.actuators))
+	for _, a := range bot.Actuators() {
+		t.Actuators[a.Name] = a.Value
+	}
+	if bot.ranger != nil {
+		if dist, err := bot.ranger.Range(); err != nil {
+			log.Printf("range: %s\n", err.Error())
+		} else if !math.IsInf(dist, 1) {
+			t.Range = &dist
+		}
+	}
+	if bot.battery != nil {
+		if status, err := bot.Battery(); err != nil {
+			log.Printf("battery: %s\n", err.Error())
+		} else {
+			t.Battery = &status
+		}
+	}
+	return t
+}
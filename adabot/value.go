@@ -0,0 +1,68 @@
+package adabot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Value is the result of an expression: a float64 number, a bool, or a
+// record of named numbers, e.g., pose().
+type Value interface{}
+
+// A field is a named number of a record.
+type field struct {
+	name  string
+	value float64
+}
+
+// A record is a value of named fields, e.g., pose().x.
+type record []field
+
+func (r record) String() string {
+	fields := make([]string, len(r))
+	for i, f := range r {
+		fields[i] = f.name + ": " + formatValue(f.value)
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// typeName returns the name of the type of v, for use in errors.
+func typeName(v Value) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case record:
+		return "record"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// formatValue formats v as the REPL prints it.
+func formatValue(v Value) string {
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// asNumber returns v if it is a number.
+func asNumber(v Value) (float64, error) {
+	if x, ok := v.(float64); ok {
+		return x, nil
+	}
+	return 0, fmt.Errorf("want a number, got %s", typeName(v))
+}
+
+// asBool returns v if it is a bool.
+func asBool(v Value) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("want a bool, got %s", typeName(v))
+}
@@ -0,0 +1,53 @@
+package adabot
+
+import (
+	"log"
+	"time"
+)
+
+// feed restarts the deadman watchdog, if one is configured.  The caller
+// must hold bot.mu.
+func (bot *Robot) feed() {
+	if bot.cfg.Watchdog <= 0 {
+		return
+	}
+	if bot.dog != nil {
+		bot.dog.Stop()
+	}
+	bot.dogGen++
+	gen := bot.dogGen
+	bot.dog = time.AfterFunc(seconds(bot.cfg.Watchdog), func() { bot.bite(gen) })
+}
+
+// bite stops the treads and the declared DC motors when the watchdog
+// expires without being fed.  Timed moves, moves and rotations end on their
+// own and are left alone.
+func (bot *Robot) bite(gen int) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	if gen != bot.dogGen {
+		return
+	}
+	running, err := bot.releaseDC(false)
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+	if bot.timer == nil && bot.motion == nil && (bot.left.target != 0 || bot.right.target != 0) {
+		running = true
+		bot.cancel()
+		if err := bot.release(); err != nil {
+			log.Printf("%s\n", err.Error())
+		}
+	}
+	if running {
+		log.Printf("watchdog: no command for %gs, stopping\n", bot.cfg.Watchdog)
+	}
+}
+
+// Keepalive tells the watchdog that the operator is still in control, e.g.
+// while a drive button is held down.
+func (bot *Robot) Keepalive() {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	bot.feed()
+}
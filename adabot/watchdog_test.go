@@ -0,0 +1,64 @@
+package adabot
+
+import (
+	"testing"
+	"time"
+)
+
+func newWatchdogRobot(t *testing.T, timeout float64) (*Robot, *SimDrive) {
+	cfg := instant(DefaultConfig())
+	cfg.Watchdog = timeout
+	return newSimRobotConfig(t, cfg)
+}
+
+func TestWatchdogStopsOpenEndedDrive(t *testing.T) {
+	bot, sim := newWatchdogRobot(t, 0.05)
+
+	bot.Drive(0.5, 0.5)
+	time.Sleep(150 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+}
+
+func TestWatchdogKeepalive(t *testing.T) {
+	bot, sim := newWatchdogRobot(t, 0.1)
+
+	bot.Drive(0.5, 0.5)
+	for i := 0; i < 6; i++ {
+		time.Sleep(40 * time.Millisecond)
+		bot.Keepalive()
+	}
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Errorf("Expected: still running, Got: %s\n", m.Dir)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+}
+
+func TestWatchdogLeavesTimedMove(t *testing.T) {
+	bot, sim := newWatchdogRobot(t, 0.05)
+
+	bot.Forward(0.2, 1)
+	time.Sleep(120 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Errorf("Expected: still running, Got: %s\n", m.Dir)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir != MotorRelease {
+		t.Errorf("Expected: release, Got: %s\n", m.Dir)
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	bot, sim := newWatchdogRobot(t, 0)
+
+	bot.Drive(0.5, 0.5)
+	time.Sleep(100 * time.Millisecond)
+	if m := sim.Motor(3); m.Dir == MotorRelease {
+		t.Errorf("Expected: still running, Got: %s\n", m.Dir)
+	}
+	bot.Stop()
+}